@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -11,7 +12,6 @@ import (
 
 	"github.com/ChristopherHX/gitea-actions-runner/config"
 	"github.com/ChristopherHX/gitea-actions-runner/core"
-	"github.com/ChristopherHX/gitea-actions-runner/exec"
 	"github.com/ChristopherHX/gitea-actions-runner/util"
 	"github.com/joho/godotenv"
 	"github.com/kardianos/service"
@@ -73,6 +73,7 @@ func Execute(ctx context.Context) {
 		SilenceUsage: true,
 	}
 	rootCmd.PersistentFlags().StringVarP(&gArgs.EnvFile, "env-file", "", ".env", "Read in a file of environment variables.")
+	rootCmd.PersistentFlags().String("config", "", "Read in a yaml config file, environment variables override its settings, defaults to GITEA_CONFIG_FILE")
 
 	// ./act_runner register
 	var regArgs registerArgs
@@ -90,11 +91,20 @@ func Execute(ctx context.Context) {
 	registerCmd.Flags().StringSliceVar(&regArgs.RunnerWorker, "worker", []string{}, fmt.Sprintf("worker args for example pwsh,actions-runner-worker.ps1,actions-runner/bin/Runner.Worker%s", suffix))
 	registerCmd.Flags().Int32Var(&regArgs.RunnerType, "type", 0, "Runner type to download, 0 for manual see --worker, 1 for official, 2 for ChristopherHX/runner.server (windows container support)")
 	registerCmd.Flags().StringVar(&regArgs.RunnerVersion, "version", "", "Runner version to download without v prefix")
+	registerCmd.Flags().StringVar(&regArgs.Setup.RunnerArchive, "runner-archive", "", "Local .tar.gz or .zip archive of the runner of --type and --version used instead of downloading it")
+	registerCmd.Flags().StringVar(&regArgs.Setup.PwshArchive, "pwsh-archive", "", "Local .tar.gz or .zip archive of pwsh used instead of downloading it if neither python nor pwsh are installed")
+	registerCmd.Flags().BoolVar(&regArgs.Setup.InsecureSkipVerify, "insecure-skip-verify", false, "Extract --runner-archive and --pwsh-archive without a pinned sha256 or <archive>.sha256 next to them")
+	registerCmd.Flags().StringVar(&regArgs.Setup.DownloadURL, "download-url", "", "Url template of the runner and pwsh downloads for a mirror, for example https://mirror/{repo}/releases/download/{tag}/{asset}, defaults to GITEA_RUNNER_DOWNLOAD_URL")
 	registerCmd.Flags().StringVar(&regArgs.InstanceAddr, "instance", "", "Gitea instance address")
 	registerCmd.Flags().StringVar(&regArgs.Token, "token", "", "Runner token")
 	registerCmd.Flags().StringVar(&regArgs.RunnerName, "name", "", "Runner name")
 	registerCmd.Flags().StringVar(&regArgs.Labels, "labels", "", "Runner tags, comma separated")
 	registerCmd.Flags().BoolVar(&regArgs.Ephemeral, "ephemeral", false, "Configure the runner to be ephemeral and only ever be able to pick a single job (stricter than --once)")
+	registerCmd.Flags().StringVar(&regArgs.PAT, "pat", "", "Personal access token to fetch the runner token, defaults to GITEA_RUNNER_PAT")
+	registerCmd.Flags().StringVar(&regArgs.Owner, "owner", "", "Register the runner for this user or organization via --pat, empty for the whole instance")
+	registerCmd.Flags().StringVar(&regArgs.Repo, "repo", "", "Register the runner for this repository of --owner via --pat")
+	registerCmd.Flags().DurationVar(&regArgs.WaitTimeout, "wait-timeout", 0, "Wait this long for the Gitea instance to become reachable, 0 waits forever")
+	registerCmd.Flags().BoolVar(&regArgs.Force, "force", false, "Register again even if the runner file already contains a registration for the instance (--no-interactive)")
 	rootCmd.AddCommand(registerCmd)
 
 	// ./act_runner daemon
@@ -105,9 +115,93 @@ func Execute(ctx context.Context) {
 		RunE:  runDaemon(ctx, gArgs.EnvFile),
 	}
 	daemonCmd.Flags().Bool("once", false, "Run one job and exit after completion")
+	daemonCmd.Flags().StringSlice("runner-file", []string{}, "Runner files of the registrations served by this daemon, defaults to GITEA_RUNNER_FILE")
+	daemonCmd.Flags().String("metrics-addr", "", "Serve prometheus metrics on this address, for example :9101")
+	daemonCmd.Flags().Int("max-jobs", 0, fmt.Sprintf("Exit with code %d after completing this amount of jobs, 0 is unlimited", ExitCodeMaxJobs))
+	daemonCmd.Flags().Duration("idle-timeout", 0, fmt.Sprintf("Exit with code %d if no job has been running for this duration, for example 10m", ExitCodeIdleTimeout))
+	daemonCmd.Flags().Duration("drain-timeout", 0, "Grace period for running jobs after SIGUSR1 requested a drain, 0 waits until all jobs are finished")
+	daemonCmd.Flags().String("record-tasks", "", "Record every fetched job with redacted secrets to this directory, replay it with exec --task")
 	// add all command
 	rootCmd.AddCommand(daemonCmd)
 
+	// ./act_runner status|pause|resume|cancel
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the slots and running tasks of the daemon",
+		Args:  cobra.MaximumNArgs(0),
+		RunE:  runStatus,
+	}
+	pauseCmd := &cobra.Command{
+		Use:   "pause",
+		Short: "Stop fetching new tasks without exiting the daemon",
+		Args:  cobra.MaximumNArgs(0),
+		RunE:  runPause,
+	}
+	resumeCmd := &cobra.Command{
+		Use:   "resume",
+		Short: "Fetch new tasks again after pause",
+		Args:  cobra.MaximumNArgs(0),
+		RunE:  runResume,
+	}
+	cancelCmd := &cobra.Command{
+		Use:   "cancel <task-id>",
+		Short: "Cancel a running task",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runCancel,
+	}
+	for _, c := range []*cobra.Command{statusCmd, pauseCmd, resumeCmd, cancelCmd} {
+		c.Flags().String("socket", "", "Control socket of the daemon, defaults to GITEA_CONTROL_SOCKET")
+		if c != cancelCmd {
+			c.Flags().Bool("json", false, "Print the status as json")
+		}
+		rootCmd.AddCommand(c)
+	}
+
+	// ./act_runner doctor
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the runner installation",
+		Args:  cobra.MaximumNArgs(0),
+		RunE:  runDoctor(gArgs.EnvFile),
+	}
+	doctorCmd.Flags().Bool("run-job", false, "Run a synthetic job to prove that the worker starts")
+	doctorCmd.Flags().Bool("check-token", false, "Verify the runner token by declaring the runner, this updates its version and labels on the server")
+	rootCmd.AddCommand(doctorCmd)
+
+	// ./act_runner gc
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove stale runner versions, clone directories and cache entries",
+		Args:  cobra.MaximumNArgs(0),
+		RunE:  runGC(gArgs.EnvFile),
+	}
+	gcCmd.Flags().Bool("dry-run", false, "Only list what would be removed")
+	gcCmd.Flags().StringSlice("runner-file", []string{}, "Runner files of all registrations using this working directory, defaults to GITEA_RUNNER_FILE")
+	gcCmd.Flags().Duration("cache-max-age", 0, "Remove cache entries written before this duration, for example 168h")
+	gcCmd.Flags().Int64("cache-max-size-mb", 0, "Remove the oldest cache entries above this total size")
+	rootCmd.AddCommand(gcCmd)
+
+	// ./act_runner generate-config
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "generate-config",
+		Short: "Print the default yaml config",
+		Args:  cobra.MaximumNArgs(0),
+		RunE:  runGenerateConfig,
+	})
+
+	// ./act_runner config validate
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the yaml config",
+	}
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "validate [file]",
+		Short: "Report unknown keys and invalid settings of the config file, defaults to --config",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runValidateConfig,
+	})
+	rootCmd.AddCommand(configCmd)
+
 	// hide completion command
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 
@@ -216,41 +310,69 @@ func Execute(ctx context.Context) {
 	cmdSvc.AddCommand(svcInstall, svcStart, svcStop, svcRun, svcUninstall)
 	rootCmd.AddCommand(cmdSvc)
 
-	filePath := ""
-	workerArgs := []string{}
-	contextPath := ""
-	varsPath := ""
-	secretsPath := ""
+	var execArgs execArgs
 	cmdExec := &cobra.Command{
 		Use:   "exec",
-		Short: "Run a command in the runner environment",
+		Short: "Run a workflow locally in the runner environment",
 		Args:  cobra.MaximumNArgs(0),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			content, _ := os.ReadFile(filePath)
-			contentData, _ := os.ReadFile(contextPath)
-			varsData, _ := os.ReadFile(varsPath)
-			secretsData, _ := os.ReadFile(secretsPath)
-			return exec.Exec(ctx, string(content), string(contentData), string(varsData), string(secretsData), workerArgs)
-		},
+		RunE:  runExec(ctx, &execArgs),
 	}
-	cmdExec.Flags().StringVar(&filePath, "file", "", "Read in a workflow file with a single job.")
-	cmdExec.Flags().StringVar(&contextPath, "context", "", "Read in a context file.")
-	cmdExec.Flags().StringVar(&varsPath, "vars-file", "", "Read in a context file.")
-	cmdExec.Flags().StringVar(&secretsPath, "secrets-file", "", "Read in a context file.")
-	cmdExec.Flags().StringSliceVar(&workerArgs, "worker", []string{}, "worker args for example pwsh,actions-runner-worker.ps1,actions-runner/bin/Runner.Worker")
+	cmdExec.Flags().StringVar(&execArgs.File, "file", "", "Read in a workflow file.")
+	cmdExec.Flags().StringVar(&execArgs.Task, "task", "", "Replay a job recorded by daemon --record-tasks, --secret and --secrets-file replace the redacted secrets.")
+	cmdExec.Flags().StringVar(&execArgs.ContextFile, "context", "", "Read in a context file.")
+	cmdExec.Flags().StringVar(&execArgs.VarsFile, "vars-file", "", "Read in a yaml file with variables.")
+	cmdExec.Flags().StringVar(&execArgs.SecretsFile, "secrets-file", "", "Read in a yaml file with secrets.")
+	cmdExec.Flags().StringVar(&execArgs.EventName, "event-name", "", "Name of the event, defaults to push or workflow_dispatch if inputs are given.")
+	cmdExec.Flags().StringVar(&execArgs.EventFile, "event", "", "Read in a json file with the event payload.")
+	cmdExec.Flags().StringArrayVar(&execArgs.Inputs, "input", []string{}, "Input of the workflow_dispatch event as key=value.")
+	cmdExec.Flags().StringArrayVar(&execArgs.Secrets, "secret", []string{}, "Secret as key=value, a single key reads the value from the environment.")
+	cmdExec.Flags().StringArrayVar(&execArgs.Vars, "var", []string{}, "Variable as key=value.")
+	cmdExec.Flags().StringArrayVar(&execArgs.Env, "env", []string{}, "Environment variable of every job as key=value, a single key reads the value from the environment.")
+	cmdExec.Flags().StringSliceVar(&execArgs.Jobs, "job", []string{}, "Run only the given jobs and the jobs they need.")
+	cmdExec.Flags().StringVar(&execArgs.LogFile, "log-file", "", "Write the log of all jobs to this file.")
+	cmdExec.Flags().StringVar(&execArgs.ResultJSON, "result-json", "", "Write the result of the jobs and steps with their timings and the job outputs as json to this file.")
+	cmdExec.Flags().StringVar(&execArgs.JUnit, "junit", "", "Write a junit xml report with a testcase per step to this file.")
+	cmdExec.Flags().BoolVar(&execArgs.DryRun, "dry-run", false, "Print the job requests of the jobs as json with redacted secrets instead of running them.")
+	cmdExec.Flags().StringVar(&execArgs.Golden, "golden", "", "Compare the job requests of --dry-run with this file and print the difference.")
+	cmdExec.Flags().BoolVar(&execArgs.Update, "update-golden", false, "Write the job requests of --dry-run to the --golden file.")
+	cmdExec.Flags().StringSliceVar(&execArgs.Worker, "worker", []string{}, "worker args for example pwsh,actions-runner-worker.ps1,actions-runner/bin/Runner.Worker")
 	rootCmd.AddCommand(cmdExec)
 
 	var capacity int
 	var allowCloneUpgrade bool
+	var updateSelfArgs struct {
+		Self     bool
+		Version  string
+		Rollback bool
+	}
 	cmdUpdate := &cobra.Command{
 		Use:   "update",
 		Short: "Update the managed runner",
 		Args:  cobra.MaximumNArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.FromEnviron()
+			cfg, err := config.Load(configFile(cmd), "")
 			if err != nil {
 				return err
 			}
+			if updateSelfArgs.Self || updateSelfArgs.Rollback {
+				if updateSelfArgs.Self && updateSelfArgs.Rollback {
+					return errors.New("--self and --rollback cannot be combined")
+				}
+				if updateSelfArgs.Rollback {
+					if err := rollbackSelf(); err != nil {
+						return err
+					}
+				} else if updated, err := updateSelf(ctx, cfg, updateSelfArgs.Version); err != nil || !updated {
+					return err
+				}
+				svc, err := service.New(&RunRunnerSvc{
+					cmd: cmd,
+				}, getSvcConfig(wd, gArgs))
+				if err != nil {
+					return err
+				}
+				return restartService(svc)
+			}
 			content, err := os.ReadFile(cfg.Runner.File)
 			if err != nil {
 				return err
@@ -268,8 +390,11 @@ func Execute(ctx context.Context) {
 			if len(regArgs.RunnerWorker) > 0 {
 				runner.RunnerWorker = regArgs.RunnerWorker
 			}
+			if regArgs.Setup.RunnerArchive != "" && regArgs.RunnerType == 0 {
+				return errors.New("--runner-archive requires --type")
+			}
 			if regArgs.RunnerType != 0 {
-				worker := util.SetupRunner(regArgs.RunnerType, regArgs.RunnerVersion)
+				worker := util.SetupRunner(regArgs.RunnerType, regArgs.RunnerVersion, setupOptions(&regArgs))
 				if worker != nil {
 					runner.RunnerWorker = worker
 				} else {
@@ -308,10 +433,21 @@ func Execute(ctx context.Context) {
 	cmdUpdate.Flags().StringSliceVar(&regArgs.RunnerWorker, "worker", []string{}, fmt.Sprintf("worker args for example pwsh,actions-runner-worker.ps1,actions-runner/bin/Runner.Worker%s", suffix))
 	cmdUpdate.Flags().Int32Var(&regArgs.RunnerType, "type", 0, "Runner type to download, 0 for manual see --worker, 1 for official, 2 for ChristopherHX/runner.server (windows container support)")
 	cmdUpdate.Flags().StringVar(&regArgs.RunnerVersion, "version", "", "Runner version to download without v prefix")
+	cmdUpdate.Flags().StringVar(&regArgs.Setup.RunnerArchive, "runner-archive", "", "Local .tar.gz or .zip archive of the runner of --type and --version used instead of downloading it")
+	cmdUpdate.Flags().StringVar(&regArgs.Setup.PwshArchive, "pwsh-archive", "", "Local .tar.gz or .zip archive of pwsh used instead of downloading it if neither python nor pwsh are installed")
+	cmdUpdate.Flags().BoolVar(&regArgs.Setup.InsecureSkipVerify, "insecure-skip-verify", false, "Extract --runner-archive and --pwsh-archive without a pinned sha256 or <archive>.sha256 next to them")
+	cmdUpdate.Flags().StringVar(&regArgs.Setup.DownloadURL, "download-url", "", "Url template of the runner and pwsh downloads for a mirror, for example https://mirror/{repo}/releases/download/{tag}/{asset}, defaults to GITEA_RUNNER_DOWNLOAD_URL")
 	cmdUpdate.Flags().BoolVar(&allowCloneUpgrade, "allow-clone-upgrade", false, "tries to upgrade an old runner setup to allow capacity > 1")
+	cmdUpdate.Flags().BoolVar(&updateSelfArgs.Self, "self", false, "Replace this binary with the latest release and restart the service")
+	cmdUpdate.Flags().StringVar(&updateSelfArgs.Version, "self-version", "", "Release tag used by --self instead of the latest release, for example v0.1.0")
+	cmdUpdate.Flags().BoolVar(&updateSelfArgs.Rollback, "rollback", false, "Restore the binary replaced by --self and restart the service")
 	rootCmd.AddCommand(cmdUpdate)
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
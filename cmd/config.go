@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+
+	"github.com/spf13/cobra"
+)
+
+// configFile returns the --config flag or GITEA_CONFIG_FILE
+func configFile(cmd *cobra.Command) string {
+	if file, _ := cmd.Flags().GetString("config"); file != "" {
+		return file
+	}
+	return os.Getenv("GITEA_CONFIG_FILE")
+}
+
+// runGenerateConfig prints the documented defaults
+func runGenerateConfig(cmd *cobra.Command, args []string) error {
+	return config.Generate(cmd.OutOrStdout(), config.Defaults())
+}
+
+// runValidateConfig loads the config file including the environment overrides
+func runValidateConfig(cmd *cobra.Command, args []string) error {
+	file := configFile(cmd)
+	if len(args) > 0 {
+		file = args[0]
+	}
+	if file == "" {
+		return fmt.Errorf("no config file, pass it as argument or use --config")
+	}
+	if _, err := config.Load(file, ""); err != nil {
+		return fmt.Errorf("invalid config %s:\n%w", file, err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", file)
+	return nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/ChristopherHX/gitea-actions-runner/control"
+
+	"github.com/spf13/cobra"
+)
+
+// controlClient connects to --socket or the socket of the config
+func controlClient(cmd *cobra.Command) (*control.Client, error) {
+	socket, _ := cmd.Flags().GetString("socket")
+	if socket == "" {
+		cfg, err := config.Load(configFile(cmd), "")
+		if err != nil {
+			return nil, err
+		}
+		socket = cfg.Control.Socket
+	}
+	if socket == "" {
+		return nil, fmt.Errorf("the control api is disabled, set GITEA_CONTROL_SOCKET or --socket")
+	}
+	return control.NewClient(socket), nil
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	cli, err := controlClient(cmd)
+	if err != nil {
+		return err
+	}
+	status, err := cli.Status(cmd.Context())
+	if err != nil {
+		return err
+	}
+	return printStatus(cmd, status)
+}
+
+func runPause(cmd *cobra.Command, args []string) error {
+	cli, err := controlClient(cmd)
+	if err != nil {
+		return err
+	}
+	status, err := cli.Pause(cmd.Context())
+	if err != nil {
+		return err
+	}
+	return printStatus(cmd, status)
+}
+
+func runResume(cmd *cobra.Command, args []string) error {
+	cli, err := controlClient(cmd)
+	if err != nil {
+		return err
+	}
+	status, err := cli.Resume(cmd.Context())
+	if err != nil {
+		return err
+	}
+	return printStatus(cmd, status)
+}
+
+func runCancel(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid task id %q", args[0])
+	}
+	cli, err := controlClient(cmd)
+	if err != nil {
+		return err
+	}
+	if err := cli.Cancel(cmd.Context(), id); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "task %d cancelled\n", id)
+	return nil
+}
+
+func printStatus(cmd *cobra.Command, status *control.Status) error {
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+	state := "fetching tasks"
+	if status.Paused {
+		state = "paused"
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s, %d busy and %d free of %d slots\n", state, status.BusySlots, status.FreeSlots, status.Capacity)
+	if len(status.Tasks) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nTASK\tREPOSITORY\tJOB\tSTARTED\tSTEP")
+	for _, task := range status.Tasks {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s ago\t%s\n", task.ID, task.Repository, task.Job, time.Since(task.StartedAt).Round(time.Second), task.Step)
+	}
+	return w.Flush()
+}
@@ -2,12 +2,25 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
 
 	"github.com/ChristopherHX/gitea-actions-runner/client"
 	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/ChristopherHX/gitea-actions-runner/control"
+	"github.com/ChristopherHX/gitea-actions-runner/labels"
+	"github.com/ChristopherHX/gitea-actions-runner/metrics"
 	"github.com/ChristopherHX/gitea-actions-runner/poller"
+	"github.com/ChristopherHX/gitea-actions-runner/register"
+	"github.com/ChristopherHX/gitea-actions-runner/resources"
 	"github.com/ChristopherHX/gitea-actions-runner/runtime"
 
 	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
@@ -24,79 +37,197 @@ func runDaemon(ctx context.Context, envFile string) func(cmd *cobra.Command, arg
 		log.Infoln("Starting runner daemon")
 
 		_ = godotenv.Load(envFile)
-		cfg, err := config.FromEnviron()
-		if err != nil {
-			log.WithError(err).
-				Fatalln("invalid configuration")
+		files, _ := cmd.Flags().GetStringSlice("runner-file")
+		if len(files) == 0 {
+			// use GITEA_RUNNER_FILE
+			files = []string{""}
 		}
+		once, _ := cmd.Flags().GetBool("once")
+		configFile := configFile(cmd)
 
-		initLogging(cfg)
+		registrations := make([]*registration, 0, len(files))
+		for _, file := range files {
+			cfg, err := config.Load(configFile, file)
+			if err != nil {
+				log.WithError(err).
+					Fatalln("invalid configuration")
+			}
+			registrations = append(registrations, &registration{
+				configFile: configFile,
+				file:       file,
+				cfg:        cfg,
+				once:       once || cfg.Runner.Ephemeral,
+			})
+		}
+
+		initLogging(registrations[0].cfg)
+
+		if registrations[0].cfg.Update.OnStart {
+			updateOnStart(ctx, registrations[0].cfg)
+		}
+		if registrations[0].cfg.GC.OnStart {
+			sweepOnStart(registrations)
+		}
 
 		var g errgroup.Group
 
-		cli := client.New(
-			cfg.Client.Address,
-			cfg.Runner.UUID,
-			cfg.Runner.Token,
-		)
-
-		runner := &runtime.Runner{
-			Client:        cli,
-			Machine:       cfg.Runner.Name,
-			ForgeInstance: cfg.Client.Address,
-			Environ:       cfg.Runner.Environ,
-			Labels:        cfg.Runner.Labels,
-			RunnerWorker:  cfg.Runner.RunnerWorker,
-		}
-		flags := []string{fmt.Sprintf("--max-parallel=%d", cfg.Runner.Capacity)}
-
-		runner.RunnerWorker = append(flags, runner.RunnerWorker...)
-
-		resp, err := cli.Declare(cmd.Context(), &connect.Request[runnerv1.DeclareRequest]{
-			Msg: &runnerv1.DeclareRequest{
-				Version: cmd.Root().Version,
-				Labels:  runner.Labels,
-			},
-		})
-		if err != nil && connect.CodeOf(err) == connect.CodeUnimplemented {
-			// Gitea instance is older version. skip declare step.
-			log.Info("Because the Gitea instance is an old version, labels can only be set during configure.")
-		} else if err != nil {
-			log.WithError(err).Error("fail to invoke Declare")
-			return err
-		} else {
-			log.Infof("runner: %s, with version: %s, with labels: %v, declare successfully",
-				resp.Msg.Runner.Name, resp.Msg.Runner.Version, resp.Msg.Runner.Labels)
+		// all registrations share the capacity of the host
+		capacity := sharedCapacity(registrations)
+		metric := metrics.New(capacity)
+		var budget *poller.Budget
+		if len(registrations) > 1 {
+			budget = poller.NewBudget(capacity)
 		}
 
-		once, _ := cmd.Flags().GetBool("once")
-		once = once || cfg.Runner.Ephemeral
-		if once {
-			cfg.Runner.Capacity = 1
-		}
-		poller := poller.New(
-			cli,
-			runner.Run,
-			cfg.Runner.Capacity,
-		)
-		poller.Once = once
-
-		g.Go(func() error {
-			l := log.WithField("capacity", cfg.Runner.Capacity).
-				WithField("endpoint", cfg.Client.Address).
-				WithField("os", cfg.Platform.OS).
-				WithField("arch", cfg.Platform.Arch)
-			l.Infoln("polling the remote server")
-
-			if err := poller.Poll(ctx); err != nil {
-				l.Errorf("poller error: %v", err)
+		// max jobs and idle timeout count the tasks of all registrations
+		maxJobs := registrations[0].cfg.Poller.MaxJobs
+		if cmd.Flags().Changed("max-jobs") {
+			maxJobs, _ = cmd.Flags().GetInt("max-jobs")
+		}
+		idleTimeout := registrations[0].cfg.Poller.IdleTimeout
+		if cmd.Flags().Changed("idle-timeout") {
+			idleTimeout, _ = cmd.Flags().GetDuration("idle-timeout")
+		}
+		limits := poller.NewLimits(maxJobs, idleTimeout)
+
+		thresholds := newThresholds(registrations[0].cfg)
+		for _, r := range registrations {
+			r.metric = metric
+			r.budget = budget
+			r.limits = limits
+			if thresholds.Enabled() {
+				r.resourceCheck = thresholds.Check
+			}
+			if err := r.start(cmd, r.cfg, capacity); err != nil {
+				return err
+			}
+		}
+
+		metricsAddr := registrations[0].cfg.Metrics.Addr
+		if cmd.Flags().Changed("metrics-addr") {
+			metricsAddr, _ = cmd.Flags().GetString("metrics-addr")
+		}
+		stopMetrics := func() {}
+		if metricsAddr != "" {
+			listener, err := net.Listen("tcp", metricsAddr)
+			if err != nil {
+				log.WithError(err).Error("cannot listen for metrics")
+				return err
+			}
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metric.Handler())
+			metricsServer := &http.Server{Handler: mux}
+			stopMetrics = func() {
+				_ = metricsServer.Shutdown(context.Background())
+			}
+			g.Go(func() error {
+				log.Infof("serving metrics on http://%s/metrics", listener.Addr())
+				if err := metricsServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.WithError(err).Error("metrics server error")
+				}
+				return nil
+			})
+		}
+
+		stopControl := func() {}
+		if socket := registrations[0].cfg.Control.Socket; socket != "" {
+			controlServer := &control.Server{
+				Socket: socket,
+				Daemon: &daemonControl{registrations: registrations, metric: metric},
+			}
+			listener, err := controlServer.Listen()
+			if err != nil {
+				log.WithError(err).Error("cannot listen for the control api")
+				return err
+			}
+			stopControl = func() {
+				controlServer.Shutdown(context.Background())
+			}
+			g.Go(func() error {
+				log.Infof("serving the control api on %s", socket)
+				if err := controlServer.Serve(listener); err != nil {
+					log.WithError(err).Error("control api error")
+				}
+				return nil
+			})
+		}
+
+		reloadChannel := make(chan os.Signal, 1)
+		signal.Notify(reloadChannel, syscall.SIGHUP)
+		defer func() {
+			signal.Stop(reloadChannel)
+			close(reloadChannel)
+		}()
+		go func() {
+			for range reloadChannel {
+				log.Info("reload: reading configuration")
+				_ = godotenv.Overload(envFile)
+				for _, r := range registrations {
+					r.reload(ctx, cmd.Root().Version)
+				}
+				capacity := sharedCapacity(registrations)
+				if budget != nil {
+					budget.SetCapacity(capacity)
+				}
+				metric.SetCapacity(capacity)
+				for _, r := range registrations {
+					r.setCapacity(capacity)
+				}
+				log.Info("reload: configuration applied to new tasks")
 			}
-			poller.Wait()
-			return nil
-		})
+		}()
 
-		err = g.Wait()
-		if err != nil {
+		var polling sync.WaitGroup
+		for _, r := range registrations {
+			polling.Add(1)
+			g.Go(func() error {
+				defer polling.Done()
+				cfg := r.config()
+				l := log.WithField("capacity", r.current().WorkerNum()).
+					WithField("endpoint", cfg.Client.Address).
+					WithField("runner", cfg.Runner.Name).
+					WithField("os", cfg.Platform.OS).
+					WithField("arch", cfg.Platform.Arch)
+				l.Infoln("polling the remote server")
+
+				for {
+					p := r.current()
+					err := p.Poll(ctx)
+					p.Wait()
+					switch {
+					case errors.Is(err, poller.ErrMaxJobsReached):
+						return &exitError{code: ExitCodeMaxJobs, err: err}
+					case errors.Is(err, poller.ErrIdleTimeout):
+						return &exitError{code: ExitCodeIdleTimeout, err: err}
+					case errors.Is(err, poller.ErrUnauthenticated):
+						if r.config().Runner.UnauthenticatedPolicy == config.UnauthenticatedReregister {
+							rerr := r.reregister(cmd, sharedCapacity(registrations))
+							if rerr == nil {
+								l.Info("runner registered again, resume polling")
+								continue
+							}
+							l.WithError(rerr).Error("cannot register the runner again")
+						}
+						return &exitError{code: ExitCodeUnauthenticated, err: err}
+					case err != nil:
+						l.Errorf("poller error: %v", err)
+					}
+					return nil
+				}
+			})
+		}
+		go func() {
+			polling.Wait()
+			stopMetrics()
+			stopControl()
+		}()
+
+		err := g.Wait()
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			log.Infof("shutting down the server: %v", err)
+			cmd.SilenceErrors = true
+		} else if err != nil {
 			log.WithError(err).
 				Errorln("shutting down the server")
 		}
@@ -104,6 +235,275 @@ func runDaemon(ctx context.Context, envFile string) func(cmd *cobra.Command, arg
 	}
 }
 
+// registration is a runner file served by the daemon
+type registration struct {
+	configFile string
+	file       string
+	once       bool
+
+	// mu guards the fields replaced by reload and reregister
+	mu     sync.Mutex
+	cfg    config.Config
+	cli    *client.HTTPClient
+	runner *runtime.Runner
+	poller *poller.Poller
+
+	metric        *metrics.Prometheus
+	budget        *poller.Budget
+	limits        *poller.Limits
+	resourceCheck func() error
+}
+
+// config returns the current configuration
+func (r *registration) config() config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// current returns the poller of the current registration
+func (r *registration) current() *poller.Poller {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.poller
+}
+
+// start declares the runner of cfg and replaces the poller, a paused poller stays paused
+func (r *registration) start(cmd *cobra.Command, cfg config.Config, capacity int) error {
+	cli := client.New(
+		cfg.Client.Address,
+		cfg.Runner.UUID,
+		cfg.Runner.Token,
+	)
+
+	runner := &runtime.Runner{
+		Client:        cli,
+		Machine:       cfg.Runner.Name,
+		ForgeInstance: cfg.Client.Address,
+		Environ:       cfg.Runner.Environ,
+		LabelEnviron:  cfg.Runner.LabelEnviron,
+		Labels:        cfg.Runner.Labels,
+		RunnerWorker:  workerArgs(cfg, capacity),
+		Metric:        r.metric,
+		Runtime:       cfg.Runtime,
+		Cache:         cfg.Cache,
+		Log:           cfg.Log,
+		RecordDir:     cfg.Runner.RecordTasks,
+	}
+	if cmd.Flags().Changed("record-tasks") {
+		runner.RecordDir, _ = cmd.Flags().GetString("record-tasks")
+	}
+
+	if err := declare(cmd.Context(), cli, cmd.Root().Version, cfg.Runner.Labels); err != nil {
+		return err
+	}
+
+	journal, err := runtime.NewJournal(filepath.Join(cfg.Runner.JournalDir, cfg.Runner.UUID))
+	if err != nil {
+		log.WithError(err).Error("cannot create the task journal")
+		return err
+	}
+	journal.Recover(cmd.Context(), cli)
+	runner.Journal = journal
+
+	p := poller.New(
+		cli,
+		runner.Run,
+		r.workerNum(capacity),
+		r.metric,
+	)
+	p.Once = r.once
+	p.Budget = r.budget
+	p.ResourceCheck = r.resourceCheck
+	p.Backoff = poller.NewBackoff(cfg.Poller.BackoffMin, cfg.Poller.BackoffMax, cfg.Poller.BackoffJitter)
+	p.DrainTimeout = cfg.Poller.DrainTimeout
+	if cmd.Flags().Changed("drain-timeout") {
+		p.DrainTimeout, _ = cmd.Flags().GetDuration("drain-timeout")
+	}
+	p.Limits = r.limits
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.poller != nil && r.poller.Paused() {
+		p.Pause()
+	}
+	r.cfg, r.cli, r.runner, r.poller = cfg, cli, runner, p
+	return nil
+}
+
+// reregister registers the runner again with the configured registration token source,
+// rewrites the runner file and creates a new poller. The poller of the old runner has to be stopped
+func (r *registration) reregister(cmd *cobra.Command, capacity int) error {
+	ctx := cmd.Context()
+	r.mu.Lock()
+	cfg, cli, runner := r.cfg, r.cli, r.runner
+	r.mu.Unlock()
+	token, err := register.RegistrationToken(ctx, cfg.Client.Address, cfg.Runner)
+	if err != nil {
+		return err
+	}
+	log.Warnf("registering %s again at %s", cfg.Runner.Name, cfg.Client.Address)
+	cfg.Runner.Token = token
+	if _, err := register.New(client.New(cfg.Client.Address, "", "")).Register(ctx, cfg.Runner); err != nil {
+		return err
+	}
+	reloaded, err := config.Load(r.configFile, r.file)
+	if err != nil {
+		return err
+	}
+	if reloaded.Runner.UUID != cfg.Runner.UUID && runner.Journal != nil {
+		// the server rejects the old runner, its tasks are reported as finished and their clone directories removed
+		runner.Journal.Recover(ctx, cli)
+		if err := os.Remove(runner.Journal.Dir); err != nil {
+			log.WithError(err).Warnf("cannot remove the journal %s of the old runner", runner.Journal.Dir)
+		}
+	}
+	return r.start(cmd, reloaded, capacity)
+}
+
+// daemonControl pauses and resumes all registrations
+type daemonControl struct {
+	registrations []*registration
+	metric        *metrics.Prometheus
+}
+
+func (d *daemonControl) Status() control.Status {
+	status := control.Status{
+		Paused:    true,
+		Capacity:  d.metric.Capacity(),
+		BusySlots: d.metric.BusyWorkers(),
+	}
+	for _, r := range d.registrations {
+		status.Paused = status.Paused && r.current().Paused()
+	}
+	status.FreeSlots = max(int64(status.Capacity)-status.BusySlots, 0)
+	return status
+}
+
+// Pause holds the lock of each registration, a poller replaced by reregister keeps the state
+func (d *daemonControl) Pause() {
+	for _, r := range d.registrations {
+		r.mu.Lock()
+		r.poller.Pause()
+		r.mu.Unlock()
+	}
+}
+
+func (d *daemonControl) Resume() {
+	for _, r := range d.registrations {
+		r.mu.Lock()
+		r.poller.Resume()
+		r.mu.Unlock()
+	}
+}
+
+// workerNum limits once and ephemeral runners to a single task
+func (r *registration) workerNum(capacity int) int {
+	if r.once {
+		return 1
+	}
+	return capacity
+}
+
+// reload reads the runner file again, running tasks are not affected
+func (r *registration) reload(ctx context.Context, version string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reloaded, err := reloadConfig(r.configFile, r.file, r.cfg)
+	if err != nil {
+		log.WithError(err).Errorf("reload: invalid configuration of %s, keep the current one", r.cfg.Runner.File)
+		return
+	}
+	if !slices.Equal(reloaded.Runner.Labels, r.cfg.Runner.Labels) {
+		if err := declare(ctx, r.cli, version, reloaded.Runner.Labels); err != nil {
+			log.WithError(err).Error("reload: labels not applied")
+			reloaded.Runner.Labels = r.cfg.Runner.Labels
+		}
+	}
+	r.cfg = reloaded
+}
+
+// setCapacity applies the shared capacity and the reloaded settings to new tasks
+func (r *registration) setCapacity(capacity int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if workerNum := r.workerNum(capacity); workerNum != r.poller.WorkerNum() {
+		log.Infof("reload: capacity of %s changed from %d to %d", r.cfg.Runner.Name, r.poller.WorkerNum(), workerNum)
+		r.poller.SetWorkerNum(workerNum)
+	}
+	r.runner.Reload(r.cfg.Runner.Environ, r.cfg.Runner.LabelEnviron, r.cfg.Runner.Labels, workerArgs(r.cfg, capacity))
+}
+
+// sharedCapacity is the highest capacity of all registrations,
+// use GITEA_RUNNER_CAPACITY to set the capacity of the host
+func sharedCapacity(registrations []*registration) int {
+	capacity := 1
+	for _, r := range registrations {
+		if c := r.config().Runner.Capacity; !r.once && c > capacity {
+			capacity = c
+		}
+	}
+	return capacity
+}
+
+// newThresholds checks the working directory, the cache and the configured directories
+func newThresholds(cfg config.Config) *resources.Thresholds {
+	dirs := []string{}
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, wd, filepath.Join(wd, "cache"))
+	}
+	return &resources.Thresholds{
+		Dirs:            append(dirs, cfg.Resources.Dirs...),
+		MinFreeDiskMB:   cfg.Resources.MinFreeDiskMB,
+		MinFreeMemoryMB: cfg.Resources.MinFreeMemoryMB,
+		MaxLoad:         cfg.Resources.MaxLoad,
+		CleanupCommand:  cfg.Resources.CleanupCommand,
+	}
+}
+
+// workerArgs returns the worker args including the flags derived from the config
+func workerArgs(cfg config.Config, capacity int) []string {
+	flags := []string{fmt.Sprintf("--max-parallel=%d", capacity)}
+	return append(flags, cfg.Runner.RunnerWorker...)
+}
+
+// declare sends the version and labels of the runner to the server
+func declare(ctx context.Context, cli client.Client, version string, runnerLabels []string) error {
+	resp, err := cli.Declare(ctx, &connect.Request[runnerv1.DeclareRequest]{
+		Msg: &runnerv1.DeclareRequest{
+			Version: version,
+			Labels:  labels.Names(runnerLabels),
+		},
+	})
+	if err != nil && connect.CodeOf(err) == connect.CodeUnimplemented {
+		// Gitea instance is older version. skip declare step.
+		log.Info("Because the Gitea instance is an old version, labels can only be set during configure.")
+	} else if err != nil {
+		log.WithError(err).Error("fail to invoke Declare")
+		return err
+	} else {
+		log.Infof("runner: %s, with version: %s, with labels: %v, declare successfully",
+			resp.Msg.Runner.Name, resp.Msg.Runner.Version, resp.Msg.Runner.Labels)
+	}
+	return nil
+}
+
+// reloadConfig reads the runner file again,
+// settings which require a new connection to the server are kept
+func reloadConfig(configFile, file string, current config.Config) (config.Config, error) {
+	cfg, err := config.Load(configFile, file)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.Client.Address != current.Client.Address || cfg.Runner.UUID != current.Runner.UUID || cfg.Runner.Token != current.Runner.Token {
+		log.Warn("reload: changes of the instance address or credentials require a restart")
+	}
+	cfg.Client = current.Client
+	cfg.Runner.UUID = current.Runner.UUID
+	cfg.Runner.Token = current.Runner.Token
+	return cfg, nil
+}
+
 // initLogging setup the global logrus logger.
 func initLogging(cfg config.Config) {
 	isTerm := isatty.IsTerminal(os.Stdout.Fd())
@@ -112,10 +512,10 @@ func initLogging(cfg config.Config) {
 		FullTimestamp: true,
 	})
 
-	if cfg.Debug {
+	if cfg.Log.Debug {
 		log.SetLevel(log.DebugLevel)
 	}
-	if cfg.Trace {
+	if cfg.Log.Trace {
 		log.SetLevel(log.TraceLevel)
 	}
 }
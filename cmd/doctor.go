@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+	"time"
+
+	pingv1 "code.gitea.io/actions-proto-go/ping/v1"
+	"github.com/ChristopherHX/gitea-actions-runner/client"
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+	runnerexec "github.com/ChristopherHX/gitea-actions-runner/exec"
+	"github.com/ChristopherHX/gitea-actions-runner/resources"
+
+	"connectrpc.com/connect"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+// doctorWorkflow is the synthetic job of doctor --run-job
+const doctorWorkflow = `on: push
+jobs:
+  doctor:
+    runs-on: self-hosted
+    steps:
+    - run: echo ok
+`
+
+// doctorMinFreeDiskMB warns about a nearly full disk of the working directory
+const doctorMinFreeDiskMB = 1024
+
+// doctor prints the result of each check and remembers failures
+type doctor struct {
+	out      io.Writer
+	failures int
+}
+
+func (d *doctor) ok(format string, args ...any) {
+	fmt.Fprintf(d.out, "[OK]   %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(format string, args ...any) {
+	fmt.Fprintf(d.out, "[WARN] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(format string, args ...any) {
+	d.failures++
+	fmt.Fprintf(d.out, "[FAIL] %s\n", fmt.Sprintf(format, args...))
+}
+
+func runDoctor(envFile string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		_ = godotenv.Load(envFile)
+		d := &doctor{out: cmd.OutOrStdout()}
+		ctx := cmd.Context()
+
+		cfg, err := config.Load(configFile(cmd), "")
+		if err != nil {
+			d.fail("configuration: %v", err)
+			return fmt.Errorf("%d checks failed", d.failures)
+		}
+		d.ok("configuration loaded")
+
+		if cfg.Runner.UUID == "" || cfg.Runner.Token == "" {
+			d.fail("%s contains no registration, run the register command", cfg.Runner.File)
+		} else {
+			d.ok("registered as %s at %s", cfg.Runner.Name, cfg.Client.Address)
+		}
+
+		d.checkWorker(ctx, cfg.Runner.RunnerWorker)
+		if cfg.Client.Address != "" {
+			checkToken, _ := cmd.Flags().GetBool("check-token")
+			d.checkInstance(ctx, cmd.Root().Version, cfg, checkToken)
+		}
+		d.checkDisk()
+		d.checkListener(cfg.Runtime.ListeningAddress)
+
+		// the synthetic job only runs on an otherwise healthy installation
+		if runJob, _ := cmd.Flags().GetBool("run-job"); runJob && d.failures == 0 {
+			d.checkJob(ctx, cfg)
+		}
+
+		if d.failures > 0 {
+			return fmt.Errorf("%d checks failed", d.failures)
+		}
+		return nil
+	}
+}
+
+// checkWorker checks the worker options, the interpreter, the worker script and Runner.Worker
+func (d *doctor) checkWorker(ctx context.Context, runnerWorker []string) {
+	command := []string{}
+	for _, arg := range runnerWorker {
+		if k, v, ok := strings.Cut(arg, "="); ok && k == "--runner-dir" {
+			d.checkRunnerDir(v)
+		} else if !strings.HasPrefix(arg, "--") {
+			command = append(command, arg)
+		}
+	}
+	if len(command) == 0 {
+		d.fail("no worker configured, register again or use the update command with --worker or --type")
+		return
+	}
+	// LookPath only finds existing executable files
+	interpreter, err := exec.LookPath(command[0])
+	if err != nil {
+		d.fail("worker %s: %v", command[0], err)
+	} else {
+		d.ok("worker %s found at %s", command[0], interpreter)
+	}
+	if err == nil && isInterpreter(command[0]) {
+		versionCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		if out, err := exec.CommandContext(versionCtx, interpreter, "--version").CombinedOutput(); err != nil {
+			d.fail("worker %s --version: %v", command[0], err)
+		} else {
+			d.ok("worker version %s", strings.TrimSpace(string(out)))
+		}
+	}
+	for _, file := range command[1:] {
+		fi, err := os.Stat(file)
+		switch {
+		case err != nil:
+			d.fail("worker file %s: %v", file, err)
+		case fi.IsDir():
+			d.fail("worker file %s is a directory", file)
+		default:
+			d.ok("worker file %s exists", file)
+		}
+	}
+	// Runner.Worker is started by the worker script
+	if len(command) >= 3 && goruntime.GOOS != "windows" {
+		if fi, err := os.Stat(command[len(command)-1]); err == nil && fi.Mode()&0o111 == 0 {
+			d.fail("%s is not executable", command[len(command)-1])
+		}
+	}
+}
+
+// isInterpreter reports whether the worker command is an interpreter known to support --version
+func isInterpreter(command string) bool {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(command), ".exe"))
+	switch {
+	case name == "pwsh", name == "node", name == "nodejs":
+		return true
+	case strings.HasPrefix(name, "python"):
+		// python, python3, python3.12
+		return strings.Trim(name[len("python"):], "0123456789.") == ""
+	}
+	return false
+}
+
+// checkRunnerDir detects missing or not extracted actions/runner directories
+func (d *doctor) checkRunnerDir(dir string) {
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		d.fail("runner directory %s does not exist, use the update command with --type to download it", dir)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bin")); err != nil {
+		d.fail("runner directory %s contains no bin directory, the actions/runner archive is not extracted", dir)
+		return
+	}
+	d.ok("runner directory %s", dir)
+}
+
+// checkInstance pings the instance, the credentials of the runner are only verified with checkToken,
+// because declaring updates the version and labels of the runner on the server
+func (d *doctor) checkInstance(ctx context.Context, version string, cfg config.Config, checkToken bool) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	cli := client.New(cfg.Client.Address, cfg.Runner.UUID, cfg.Runner.Token)
+	if _, err := cli.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Data: cfg.Runner.Name})); err != nil {
+		d.fail("instance %s not reachable: %v", cfg.Client.Address, err)
+		return
+	}
+	d.ok("instance %s reachable", cfg.Client.Address)
+	if cfg.Runner.UUID == "" || !checkToken {
+		return
+	}
+	err := declare(ctx, cli, version, cfg.Runner.Labels)
+	switch {
+	case err == nil:
+		d.ok("runner token accepted")
+	case connect.CodeOf(err) == connect.CodeUnauthenticated:
+		d.fail("runner token rejected, the runner has been removed or the token is invalid: %v", err)
+	default:
+		d.fail("declare: %v", err)
+	}
+}
+
+// checkDisk checks the free disk of the working directory and the permissions of the cache directory
+func (d *doctor) checkDisk() {
+	wd, err := os.Getwd()
+	if err != nil {
+		d.fail("working directory: %v", err)
+		return
+	}
+	if free, err := resources.FreeDiskMB(wd); err != nil {
+		d.warn("free disk of %s: %v", wd, err)
+	} else if free < doctorMinFreeDiskMB {
+		d.warn("free disk of %s is %d MB", wd, free)
+	} else {
+		d.ok("free disk of %s is %d MB", wd, free)
+	}
+	cache := filepath.Join(wd, "cache")
+	if err := os.MkdirAll(cache, 0o755); err != nil {
+		d.fail("cache directory %s: %v", cache, err)
+		return
+	}
+	f, err := os.CreateTemp(cache, "doctor-*")
+	if err != nil {
+		d.fail("cache directory %s is not writable: %v", cache, err)
+		return
+	}
+	f.Close()
+	_ = os.Remove(f.Name())
+	d.ok("cache directory %s is writable", cache)
+}
+
+// checkListener binds the listening address of the runtime server
+func (d *doctor) checkListener(addr string) {
+	if addr == "" {
+		addr = ":0"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		d.fail("runtime listening address %s: %v", addr, err)
+		return
+	}
+	listener.Close()
+	d.ok("runtime listening address %s can be bound", addr)
+}
+
+// checkJob runs a synthetic job through the exec path to prove that the worker starts
+func (d *doctor) checkJob(ctx context.Context, cfg config.Config) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+	result, err := runnerexec.Exec(ctx, cfg, runnerexec.Options{
+		Workflow: []byte(doctorWorkflow),
+		Worker:   cfg.Runner.RunnerWorker,
+	})
+	if err == nil && result.Failed() {
+		err = fmt.Errorf("finished with result %s", result.Result)
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out")
+		}
+		d.fail("synthetic job: %v", err)
+		return
+	}
+	d.ok("synthetic job finished")
+}
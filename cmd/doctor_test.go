@@ -0,0 +1,42 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsInterpreter(t *testing.T) {
+	for _, name := range []string{"python", "python3", "/usr/bin/python3.12", "pwsh", "pwsh.exe", "node"} {
+		assert.True(t, isInterpreter(name), name)
+	}
+	for _, name := range []string{"/opt/runner/run.sh", "pythonworker", "nodes", "bash"} {
+		assert.False(t, isInterpreter(name), name)
+	}
+}
+
+func TestCheckWorkerNotAnInterpreter(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "started")
+	worker := filepath.Join(dir, "worker.sh")
+	assert.NoError(t, os.WriteFile(worker, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0o755))
+
+	out := &bytes.Buffer{}
+	d := &doctor{out: out}
+	d.checkWorker(context.Background(), []string{worker})
+	assert.Equal(t, 0, d.failures, out.String())
+	// the worker is not started with --version
+	_, err := os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, os.Chmod(worker, 0o644))
+	d = &doctor{out: out}
+	d.checkWorker(context.Background(), []string{worker})
+	assert.Equal(t, 1, d.failures, out.String())
+}
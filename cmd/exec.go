@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/ChristopherHX/gitea-actions-runner/exec"
+	"github.com/ChristopherHX/gitea-actions-runner/runtime"
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+type execArgs struct {
+	File        string
+	ContextFile string
+	VarsFile    string
+	SecretsFile string
+	EventName   string
+	EventFile   string
+	Inputs      []string
+	Secrets     []string
+	Vars        []string
+	Env         []string
+	Jobs        []string
+	Worker      []string
+	LogFile     string
+	ResultJSON  string
+	JUnit       string
+	DryRun      bool
+	Golden      string
+	Update      bool
+	Task        string
+}
+
+// runExec runs a workflow file locally
+func runExec(ctx context.Context, execArgs *execArgs) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(configFile(cmd), "")
+		if err != nil {
+			return err
+		}
+		opts, err := execArgs.options()
+		if err != nil {
+			return err
+		}
+		if execArgs.DryRun {
+			if execArgs.Task != "" {
+				return fmt.Errorf("--dry-run does not support --task")
+			}
+			return renderExec(ctx, cfg, opts, execArgs)
+		}
+		if execArgs.LogFile != "" {
+			logFile, err := os.Create(execArgs.LogFile)
+			if err != nil {
+				return err
+			}
+			defer logFile.Close()
+			opts.Log = io.MultiWriter(os.Stdout, logFile)
+		}
+		var result *exec.Result
+		if execArgs.Task != "" {
+			task, rerr := runtime.ReadTask(execArgs.Task)
+			if rerr != nil {
+				return rerr
+			}
+			result, err = exec.Replay(ctx, cfg, task, opts)
+		} else {
+			result, err = exec.Exec(ctx, cfg, opts)
+		}
+		if result == nil {
+			return err
+		}
+		if execArgs.ResultJSON != "" {
+			if werr := writeFile(execArgs.ResultJSON, result.WriteJSON); werr != nil {
+				return werr
+			}
+		}
+		if execArgs.JUnit != "" {
+			if werr := writeFile(execArgs.JUnit, result.WriteJUnit); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if result.Cancelled() {
+			return &exitError{code: ExitCodeJobCancelled, err: fmt.Errorf("workflow cancelled")}
+		}
+		if result.Failed() {
+			return &exitError{code: ExitCodeJobFailed, err: fmt.Errorf("workflow failed")}
+		}
+		return nil
+	}
+}
+
+// renderExec prints the job requests or compares them with the golden file
+func renderExec(ctx context.Context, cfg config.Config, opts exec.Options, execArgs *execArgs) error {
+	rendered, err := exec.Render(ctx, cfg, opts)
+	if err != nil {
+		return err
+	}
+	if execArgs.Golden == "" {
+		_, err := os.Stdout.Write(rendered)
+		return err
+	}
+	if execArgs.Update {
+		return os.WriteFile(execArgs.Golden, rendered, 0o644)
+	}
+	golden, err := os.ReadFile(execArgs.Golden)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(golden, rendered) {
+		log.Infof("job requests match %s", execArgs.Golden)
+		return nil
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(golden)),
+		B:        difflib.SplitLines(string(rendered)),
+		FromFile: execArgs.Golden,
+		ToFile:   "rendered",
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Print(diff)
+	return fmt.Errorf("job requests differ from %s", execArgs.Golden)
+}
+
+func writeFile(file string, write func(io.Writer) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// options reads the files and merges the flags, flags take precedence over the files
+func (a *execArgs) options() (exec.Options, error) {
+	opts := exec.Options{
+		EventName: a.EventName,
+		Context:   map[string]any{},
+		Secrets:   map[string]string{},
+		Vars:      map[string]string{},
+		Jobs:      a.Jobs,
+		Worker:    a.Worker,
+	}
+	var err error
+	if a.Task == "" {
+		if a.File == "" {
+			return opts, fmt.Errorf("--file or --task is required")
+		}
+		if opts.Workflow, err = os.ReadFile(a.File); err != nil {
+			return opts, err
+		}
+	}
+	if err := readYAMLFile(a.ContextFile, &opts.Context); err != nil {
+		return opts, err
+	}
+	if err := readYAMLFile(a.VarsFile, &opts.Vars); err != nil {
+		return opts, err
+	}
+	if err := readYAMLFile(a.SecretsFile, &opts.Secrets); err != nil {
+		return opts, err
+	}
+	if a.EventFile != "" {
+		content, err := os.ReadFile(a.EventFile)
+		if err != nil {
+			return opts, err
+		}
+		if err := json.Unmarshal(content, &opts.Event); err != nil {
+			return opts, fmt.Errorf("%s: %w", a.EventFile, err)
+		}
+	}
+
+	if opts.Inputs, err = parseKeyValues(a.Inputs, false); err != nil {
+		return opts, fmt.Errorf("--input: %w", err)
+	}
+	secrets, err := parseKeyValues(a.Secrets, true)
+	if err != nil {
+		return opts, fmt.Errorf("--secret: %w", err)
+	}
+	vars, err := parseKeyValues(a.Vars, false)
+	if err != nil {
+		return opts, fmt.Errorf("--var: %w", err)
+	}
+	if opts.Env, err = parseKeyValues(a.Env, true); err != nil {
+		return opts, fmt.Errorf("--env: %w", err)
+	}
+	for k, v := range secrets {
+		opts.Secrets[k] = v
+	}
+	for k, v := range vars {
+		opts.Vars[k] = v
+	}
+	return opts, nil
+}
+
+func readYAMLFile(file string, out any) error {
+	if file == "" {
+		return nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// parseKeyValues parses key=value pairs, with fromEnv a single key reads the value from the process environment
+func parseKeyValues(pairs []string, fromEnv bool) (map[string]string, error) {
+	values := map[string]string{}
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok && fromEnv {
+			v, ok = os.LookupEnv(k)
+			if !ok {
+				return nil, fmt.Errorf("%s is not set in the environment", k)
+			}
+		}
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid value %q, expected key=value", pair)
+		}
+		values[k] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,26 @@
+package cmd
+
+// Exit codes of planned shutdowns, orchestrators use them to tell a scale down from an error
+const (
+	ExitCodeMaxJobs     = 3
+	ExitCodeIdleTimeout = 4
+	// ExitCodeUnauthenticated means the runner has been removed from the server or its token is invalid
+	ExitCodeUnauthenticated = 5
+	// ExitCodeJobFailed and ExitCodeJobCancelled report the result of exec
+	ExitCodeJobFailed    = 6
+	ExitCodeJobCancelled = 7
+)
+
+// exitError terminates the process with a dedicated exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/ChristopherHX/gitea-actions-runner/gc"
+	"github.com/ChristopherHX/gitea-actions-runner/runtime"
+
+	"github.com/joho/godotenv"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func runGC(envFile string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		_ = godotenv.Load(envFile)
+		files, _ := cmd.Flags().GetStringSlice("runner-file")
+		if len(files) == 0 {
+			// use GITEA_RUNNER_FILE
+			files = []string{""}
+		}
+		cfgs := make([]config.Config, 0, len(files))
+		for _, file := range files {
+			cfg, err := config.Load(configFile(cmd), file)
+			if err != nil {
+				return err
+			}
+			cfgs = append(cfgs, cfg)
+		}
+		opts, err := gcOptions(cfgs)
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("cache-max-age") {
+			opts.CacheMaxAge, _ = cmd.Flags().GetDuration("cache-max-age")
+		}
+		if cmd.Flags().Changed("cache-max-size-mb") {
+			size, _ := cmd.Flags().GetInt64("cache-max-size-mb")
+			opts.CacheMaxSize = size << 20
+		}
+		opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		items, err := gc.Run(opts)
+		if err != nil {
+			return err
+		}
+		printGC(cmd.OutOrStdout(), items, opts.DryRun)
+		return nil
+	}
+}
+
+// gcOptions collects the worker args and the clone directories of running tasks of the registrations,
+// runner versions are kept if the worker of a registration is unknown
+func gcOptions(cfgs []config.Config) (gc.Options, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return gc.Options{}, err
+	}
+	opts := gc.Options{
+		Dir:          wd,
+		CacheMaxAge:  cfgs[0].GC.CacheMaxAge,
+		CacheMaxSize: cfgs[0].GC.CacheMaxSizeMB << 20,
+	}
+	var journals []string
+	for _, cfg := range cfgs {
+		opts.Workers = append(opts.Workers, cfg.Runner.RunnerWorker)
+		if cfg.Runner.JournalDir != "" && !slices.Contains(journals, cfg.Runner.JournalDir) {
+			journals = append(journals, cfg.Runner.JournalDir)
+		}
+	}
+	if slices.ContainsFunc(opts.Workers, func(worker []string) bool { return len(worker) == 0 }) {
+		opts.Workers = nil
+	}
+	for _, journal := range journals {
+		owned, err := runtime.CloneDirs(journal)
+		if err != nil {
+			return opts, err
+		}
+		opts.Owned = append(opts.Owned, owned...)
+	}
+	return opts, nil
+}
+
+func printGC(w io.Writer, items []gc.Item, dryRun bool) {
+	action := "removed"
+	if dryRun {
+		action = "would remove"
+	}
+	var total int64
+	for _, item := range items {
+		total += item.Size
+		fmt.Fprintf(w, "%s %s (%.1f MB): %s\n", action, item.Path, float64(item.Size)/(1<<20), item.Reason)
+	}
+	fmt.Fprintf(w, "%s %d items, %.1f MB\n", action, len(items), float64(total)/(1<<20))
+}
+
+// sweepOnStart removes stale files before the daemon starts, failures are logged
+func sweepOnStart(registrations []*registration) {
+	cfgs := make([]config.Config, 0, len(registrations))
+	for _, r := range registrations {
+		cfgs = append(cfgs, r.config())
+	}
+	opts, err := gcOptions(cfgs)
+	if err == nil {
+		var items []gc.Item
+		items, err = gc.Run(opts)
+		for _, item := range items {
+			log.Infof("gc: removed %s: %s", item.Path, item.Reason)
+		}
+	}
+	if err != nil {
+		log.WithError(err).Warn("gc: failed to remove stale files")
+	}
+}
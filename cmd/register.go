@@ -13,6 +13,8 @@ import (
 	pingv1 "code.gitea.io/actions-proto-go/ping/v1"
 	"github.com/ChristopherHX/gitea-actions-runner/client"
 	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/ChristopherHX/gitea-actions-runner/labels"
+	"github.com/ChristopherHX/gitea-actions-runner/poller"
 	"github.com/ChristopherHX/gitea-actions-runner/register"
 	"github.com/ChristopherHX/gitea-actions-runner/util"
 
@@ -36,6 +38,7 @@ func runRegister(ctx context.Context, regArgs *registerArgs, envFile string) fun
 
 		log.Infof("Registering runner, arch=%s, os=%s, version=%s.",
 			runtime.GOARCH, runtime.GOOS, version)
+		regArgs.ConfigFile = configFile(cmd)
 
 		if regArgs.NoInteractive {
 			if err := registerNoInteractive(envFile, regArgs); err != nil {
@@ -62,6 +65,7 @@ func runRegister(ctx context.Context, regArgs *registerArgs, envFile string) fun
 
 // registerArgs represents the arguments for register command
 type registerArgs struct {
+	ConfigFile    string
 	NoInteractive bool
 	RunnerWorker  []string
 	InstanceAddr  string
@@ -70,7 +74,13 @@ type registerArgs struct {
 	Labels        string
 	RunnerType    int32
 	RunnerVersion string
+	Setup         util.SetupOptions
 	Ephemeral     bool
+	PAT           string
+	Owner         string
+	Repo          string
+	WaitTimeout   time.Duration
+	Force         bool
 }
 
 type registerStage int8
@@ -103,15 +113,26 @@ type registerInputs struct {
 	CustomLabels  []string
 	RunnerType    int32
 	RunnerVersion string
+	Setup         util.SetupOptions
 	Ephemeral     bool
+	PAT           string
+	Owner         string
+	Repo          string
+	WaitTimeout   time.Duration
 }
 
 func (r *registerInputs) validate() error {
 	if r.InstanceAddr == "" {
 		return fmt.Errorf("instance address is empty")
 	}
-	if r.Token == "" {
-		return fmt.Errorf("token is empty")
+	if r.Token == "" && r.PAT == "" {
+		return fmt.Errorf("token is empty, provide --token or --pat")
+	}
+	if r.Repo != "" && r.Owner == "" {
+		return fmt.Errorf("--repo requires --owner")
+	}
+	if r.Setup.RunnerArchive != "" && r.RunnerType == 0 {
+		return fmt.Errorf("--runner-archive requires --type")
 	}
 	if r.RunnerType != 0 {
 		if r.setupRunner() != StageInputInstance {
@@ -127,8 +148,17 @@ func (r *registerInputs) validate() error {
 	return nil
 }
 
-func validateLabels(labels []string) error {
-	return nil
+// splitLabels splits comma separated labels and ignores surrounding spaces
+func splitLabels(value string) []string {
+	runnerLabels := strings.Split(value, ",")
+	for i, label := range runnerLabels {
+		runnerLabels[i] = strings.TrimSpace(label)
+	}
+	return runnerLabels
+}
+
+func validateLabels(runnerLabels []string) error {
+	return labels.Validate(runnerLabels)
 }
 
 func (r *registerInputs) stageValue(stage registerStage) string {
@@ -214,11 +244,12 @@ func (r *registerInputs) assignToNext(stage registerStage, value string) registe
 	case StageInputCustomLabels:
 		r.CustomLabels = defaultLabels
 		if value != "" {
-			r.CustomLabels = strings.Split(value, ",")
+			r.CustomLabels = splitLabels(value)
 		}
 
-		if validateLabels(r.CustomLabels) != nil {
-			log.Infoln("Invalid labels, please input again, leave blank to use the default labels (for example, self-hosted,ubuntu-latest)")
+		if err := validateLabels(r.CustomLabels); err != nil {
+			log.Errorln(err)
+			log.Infoln("Invalid labels, please input again, leave blank to use the default labels (for example, self-hosted,ubuntu-latest:docker://node:20)")
 			r.CustomLabels = nil
 			return StageInputCustomLabels
 		}
@@ -228,7 +259,7 @@ func (r *registerInputs) assignToNext(stage registerStage, value string) registe
 }
 
 func (r *registerInputs) setupRunner() registerStage {
-	rargs := util.SetupRunner(r.RunnerType, r.RunnerVersion)
+	rargs := util.SetupRunner(r.RunnerType, r.RunnerVersion, r.Setup)
 	if len(rargs) == 0 {
 		r.RunnerVersion = ""
 		log.Infoln("Failed to setup runner, please check the input.")
@@ -247,7 +278,7 @@ func registerInteractive(envFile string, regArgs *registerArgs) error {
 
 	// check if overwrite local config
 	_ = godotenv.Load(envFile)
-	cfg, _ := config.FromEnviron()
+	cfg, _ := config.Load(regArgs.ConfigFile, "")
 	if f, err := os.Stat(cfg.Runner.File); err == nil && !f.IsDir() {
 		stage = StageOverwriteLocalConfig
 	}
@@ -315,7 +346,11 @@ func printStageHelp(stage registerStage) {
 
 func registerNoInteractive(envFile string, regArgs *registerArgs) error {
 	_ = godotenv.Load(envFile)
-	cfg, _ := config.FromEnviron()
+	cfg, _ := config.Load(regArgs.ConfigFile, "")
+	if !regArgs.Force && isRegistered(cfg, regArgs.InstanceAddr) {
+		log.Infof("Runner is already registered to %s in %s, skip registration. Use --force to register again.", cfg.Client.Address, cfg.Runner.File)
+		return nil
+	}
 	inputs := initInputs(regArgs)
 	if len(inputs.CustomLabels) == 0 {
 		inputs.CustomLabels = defaultLabels
@@ -326,16 +361,34 @@ func registerNoInteractive(envFile string, regArgs *registerArgs) error {
 	}
 	if err := inputs.validate(); err != nil {
 		log.WithError(err).Errorf("Invalid input, please re-run act command.")
-		return nil
+		return err
 	}
 	if err := doRegister(&cfg, inputs); err != nil {
 		log.Errorf("Failed to register runner: %v", err)
-		return nil
+		return err
 	}
 	log.Infof("Runner registered successfully.")
 	return nil
 }
 
+// isRegistered reports whether the runner file contains credentials for the instance
+func isRegistered(cfg config.Config, instance string) bool {
+	if cfg.Runner.UUID == "" || cfg.Runner.Token == "" || instance == "" {
+		return false
+	}
+	return strings.TrimRight(cfg.Client.Address, "/") == strings.TrimRight(instance, "/")
+}
+
+// setupOptions returns the local archives and the download url of the runner setup,
+// the download url defaults to GITEA_RUNNER_DOWNLOAD_URL
+func setupOptions(regArgs *registerArgs) util.SetupOptions {
+	opts := regArgs.Setup
+	if opts.DownloadURL == "" {
+		opts.DownloadURL = os.Getenv("GITEA_RUNNER_DOWNLOAD_URL")
+	}
+	return opts
+}
+
 func initInputs(regArgs *registerArgs) *registerInputs {
 	inputs := &registerInputs{
 		RunnerWorker:  regArgs.RunnerWorker,
@@ -344,11 +397,19 @@ func initInputs(regArgs *registerArgs) *registerInputs {
 		RunnerName:    regArgs.RunnerName,
 		RunnerType:    regArgs.RunnerType,
 		RunnerVersion: regArgs.RunnerVersion,
+		Setup:         setupOptions(regArgs),
 		Ephemeral:     regArgs.Ephemeral,
+		PAT:           regArgs.PAT,
+		Owner:         regArgs.Owner,
+		Repo:          regArgs.Repo,
+		WaitTimeout:   regArgs.WaitTimeout,
+	}
+	if inputs.PAT == "" {
+		inputs.PAT = os.Getenv("GITEA_RUNNER_PAT")
 	}
 	regArgs.Labels = strings.TrimSpace(regArgs.Labels)
 	if regArgs.Labels != "" {
-		inputs.CustomLabels = strings.Split(regArgs.Labels, ",")
+		inputs.CustomLabels = splitLabels(regArgs.Labels)
 	}
 	return inputs
 }
@@ -362,27 +423,17 @@ func doRegister(cfg *config.Config, inputs *registerInputs) error {
 		"", "",
 	)
 
-	for {
-		_, err := cli.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{
-			Data: inputs.RunnerName,
-		}))
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-		}
-		if ctx.Err() != nil {
-			break
-		}
+	if err := waitForInstance(ctx, cli, inputs.RunnerName, inputs.WaitTimeout); err != nil {
+		return err
+	}
+
+	if inputs.Token == "" {
+		token, err := register.FetchRegistrationToken(ctx, inputs.InstanceAddr, inputs.PAT, inputs.Owner, inputs.Repo)
 		if err != nil {
-			log.WithError(err).
-				Errorln("Cannot ping the Gitea instance server")
-			// TODO: if ping failed, retry or exit
-			time.Sleep(time.Second)
-		} else {
-			log.Debugln("Successfully pinged the Gitea instance server")
-			break
+			return err
 		}
+		log.Debugln("Successfully fetched the registration token")
+		inputs.Token = token
 	}
 
 	cfg.Runner.Name = inputs.RunnerName
@@ -393,3 +444,30 @@ func doRegister(cfg *config.Config, inputs *registerInputs) error {
 	_, err := register.New(cli).Register(ctx, cfg.Runner)
 	return err
 }
+
+// waitForInstance pings the Gitea instance until it is reachable, a timeout of 0 waits forever
+func waitForInstance(ctx context.Context, cli client.Client, name string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	backoff := poller.NewBackoff(time.Second, 30*time.Second, 0.2)
+	for {
+		_, err := cli.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{
+			Data: name,
+		}))
+		if err == nil {
+			log.Debugln("Successfully pinged the Gitea instance server")
+			return nil
+		}
+		delay := backoff.Next()
+		log.WithError(err).
+			Errorf("Cannot ping the Gitea instance server, retrying in %v", delay.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gitea instance not reachable: %w", err)
+		case <-time.After(delay):
+		}
+	}
+}
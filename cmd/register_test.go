@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pingv1 "code.gitea.io/actions-proto-go/ping/v1"
+	"github.com/ChristopherHX/gitea-actions-runner/client"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+)
+
+// pingClient fails until ready is reached
+type pingClient struct {
+	client.Client
+	pings int
+	ready int
+}
+
+func (c *pingClient) Ping(ctx context.Context, req *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+	c.pings++
+	if c.pings < c.ready {
+		return nil, connect.NewError(connect.CodeUnavailable, errors.New("connection refused"))
+	}
+	return connect.NewResponse(&pingv1.PingResponse{Data: req.Msg.Data}), nil
+}
+
+func TestWaitForInstance(t *testing.T) {
+	cli := &pingClient{ready: 2}
+	start := time.Now()
+	assert.NoError(t, waitForInstance(context.Background(), cli, "runner", time.Minute))
+	assert.Equal(t, 2, cli.pings)
+	// the second ping is delayed by the backoff
+	assert.GreaterOrEqual(t, time.Since(start), 800*time.Millisecond)
+
+	cli = &pingClient{ready: 100}
+	err := waitForInstance(context.Background(), cli, "runner", 100*time.Millisecond)
+	assert.ErrorContains(t, err, "gitea instance not reachable")
+	assert.Equal(t, 1, cli.pings)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/ChristopherHX/gitea-actions-runner/selfupdate"
+	"github.com/kardianos/service"
+	log "github.com/sirupsen/logrus"
+)
+
+// updateSelf replaces the running binary with the release tag, an empty tag uses the latest release.
+// It reports false if the binary is already up to date
+func updateSelf(ctx context.Context, cfg config.Config, tag string) (bool, error) {
+	if tag == "" {
+		latest, err := selfupdate.Latest(ctx, cfg.Update.Repository)
+		if err != nil {
+			return false, err
+		}
+		if !selfupdate.Newer(latest, version) {
+			log.Infof("update: version %s is up to date, latest release is %s", version, latest)
+			return false, nil
+		}
+		tag = latest
+	}
+	exe, err := selfupdate.Executable()
+	if err != nil {
+		return false, err
+	}
+	if err := selfupdate.Update(ctx, log.StandardLogger(), cfg.Update.Repository, tag, exe); err != nil {
+		return false, err
+	}
+	log.Infof("update: updated %s from %s to %s", exe, version, tag)
+	return true, nil
+}
+
+// rollbackSelf restores the binary replaced by the last update --self
+func rollbackSelf() error {
+	exe, err := selfupdate.Executable()
+	if err != nil {
+		return err
+	}
+	if err := selfupdate.Rollback(exe); err != nil {
+		return err
+	}
+	log.Infof("update: restored the previous binary of %s", exe)
+	return nil
+}
+
+// restartService restarts the installed service to use the replaced binary
+func restartService(svc service.Service) error {
+	status, err := svc.Status()
+	if errors.Is(err, service.ErrNotInstalled) || err == nil && status != service.StatusRunning {
+		log.Info("update: the service is not running, restart the runner to use the new binary")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.Info("update: restarting the service")
+	return svc.Restart()
+}
+
+// updateOnStart updates the binary to the latest release and restarts the daemon in place,
+// failures are logged and the daemon continues with the current binary
+func updateOnStart(ctx context.Context, cfg config.Config) {
+	updated, err := updateSelf(ctx, cfg, "")
+	if err != nil {
+		log.WithError(err).Warn("update: failed to update the runner binary")
+		return
+	}
+	if !updated {
+		return
+	}
+	exe, err := selfupdate.Executable()
+	if err == nil {
+		err = selfupdate.Restart(exe)
+	}
+	log.WithError(err).Warn("update: continuing with the previous binary until the next restart")
+}
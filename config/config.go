@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/ChristopherHX/gitea-actions-runner/core"
 
@@ -13,14 +14,34 @@ import (
 	"github.com/kelseyhightower/envconfig"
 )
 
+// Policies of the daemon when the server rejects the runner token
+const (
+	UnauthenticatedExit       = "exit"
+	UnauthenticatedReregister = "reregister"
+)
+
 type (
 	// Config provides the system configuration.
 	Config struct {
-		Debug    bool `envconfig:"GITEA_DEBUG"`
-		Trace    bool `envconfig:"GITEA_TRACE"`
-		Client   Client
-		Runner   Runner
-		Platform Platform
+		Log       Log       `yaml:"log"`
+		Client    Client    `yaml:"-"`
+		Runner    Runner    `yaml:"runner"`
+		Platform  Platform  `yaml:"platform"`
+		Poller    Poller    `yaml:"poller"`
+		Runtime   Runtime   `yaml:"runtime"`
+		Cache     Cache     `yaml:"cache"`
+		Metrics   Metrics   `yaml:"metrics"`
+		Control   Control   `yaml:"control"`
+		Resources Resources `yaml:"resources"`
+		Update    Update    `yaml:"update"`
+		GC        GC        `yaml:"gc"`
+	}
+
+	Log struct {
+		Debug bool `yaml:"debug" envconfig:"GITEA_DEBUG" desc:"log debug messages"`
+		Trace bool `yaml:"trace" envconfig:"GITEA_TRACE" desc:"log trace messages"`
+		// Messages prints the messages of the worker
+		Messages Bool `yaml:"messages" envconfig:"GITEA_RUNNER_TRACE" desc:"print the messages sent by the worker"`
 	}
 
 	Client struct {
@@ -28,30 +49,145 @@ type (
 	}
 
 	Runner struct {
-		UUID         string            `ignored:"true"`
-		Name         string            `envconfig:"GITEA_RUNNER_NAME"`
-		Token        string            `ignored:"true"`
-		RunnerWorker []string          `envconfig:"GITEA_RUNNER_WORKER"`
-		Capacity     int               `envconfig:"GITEA_RUNNER_CAPACITY"`
-		File         string            `envconfig:"GITEA_RUNNER_FILE" default:".runner"`
-		Environ      map[string]string `envconfig:"GITEA_RUNNER_ENVIRON"`
-		EnvFile      string            `envconfig:"GITEA_RUNNER_ENV_FILE"`
-		Labels       []string          `envconfig:"GITEA_RUNNER_LABELS"`
-		Ephemeral    bool              `ignored:"true"`
+		UUID         string            `yaml:"-" ignored:"true"`
+		Name         string            `yaml:"name" envconfig:"GITEA_RUNNER_NAME" desc:"name of the runner, defaults to the registered name or the hostname"`
+		Token        string            `yaml:"-" ignored:"true"`
+		RunnerWorker []string          `yaml:"worker" envconfig:"GITEA_RUNNER_WORKER" desc:"worker args, defaults to the registered worker"`
+		Capacity     int               `yaml:"capacity" envconfig:"GITEA_RUNNER_CAPACITY" desc:"amount of parallel jobs, defaults to the registered capacity or 1"`
+		File         string            `yaml:"file" envconfig:"GITEA_RUNNER_FILE" desc:"registration of the runner"`
+		Environ      map[string]string `yaml:"environ" envconfig:"GITEA_RUNNER_ENVIRON" desc:"environment variables of the jobs"`
+		EnvFile      string            `yaml:"env_file" envconfig:"GITEA_RUNNER_ENV_FILE" desc:"godotenv file with environment variables of the jobs"`
+		// LabelEnviron is applied on top of Environ for jobs with the label in runs-on
+		LabelEnviron  map[string]map[string]string `yaml:"label_environ" ignored:"true" desc:"environment variables of the jobs by runs-on label, for example ubuntu-latest: {HTTP_PROXY: http://proxy:3128}"`
+		LabelEnvFiles map[string]string            `yaml:"label_env_files" envconfig:"GITEA_RUNNER_LABEL_ENV_FILES" desc:"godotenv files with environment variables of the jobs by runs-on label, for example ubuntu-latest:ubuntu.env"`
+		Labels        []string                     `yaml:"labels" envconfig:"GITEA_RUNNER_LABELS" desc:"labels of the runner, defaults to the registered labels"`
+		Ephemeral     bool                         `yaml:"-" ignored:"true"`
+		// JournalDir stores the running tasks to report them after a crash of the daemon
+		JournalDir string `yaml:"journal_dir" envconfig:"GITEA_RUNNER_JOURNAL_DIR" desc:"stores the running jobs to report them after a crash of the daemon"`
+		// RecordTasks stores every fetched task with redacted secrets to replay it via exec --task
+		RecordTasks string `yaml:"record_tasks" envconfig:"GITEA_RUNNER_RECORD_TASKS" desc:"directory to record the fetched jobs with redacted secrets, replay them with exec --task"`
+		// UnauthenticatedPolicy is either exit or reregister when the server rejects the runner token
+		UnauthenticatedPolicy string `yaml:"unauthenticated_policy" envconfig:"GITEA_RUNNER_UNAUTHENTICATED_POLICY" desc:"exit or reregister when the server keeps rejecting the runner token"`
+		// registration token source used by the reregister policy
+		RegistrationToken     string `yaml:"registration_token" envconfig:"GITEA_RUNNER_REGISTRATION_TOKEN" desc:"registration token used by the reregister policy"`
+		RegistrationTokenFile string `yaml:"registration_token_file" envconfig:"GITEA_RUNNER_REGISTRATION_TOKEN_FILE" desc:"file containing the registration token"`
+		PAT                   string `yaml:"pat" envconfig:"GITEA_RUNNER_PAT" desc:"personal access token to fetch a registration token"`
+		Owner                 string `yaml:"owner" envconfig:"GITEA_RUNNER_OWNER" desc:"user or organization of the registration fetched via pat, empty for the whole instance"`
+		Repo                  string `yaml:"repo" envconfig:"GITEA_RUNNER_REPO" desc:"repository of owner of the registration fetched via pat"`
+	}
+
+	Poller struct {
+		BackoffMin    time.Duration `yaml:"backoff_min" envconfig:"GITEA_POLLER_BACKOFF_MIN" desc:"first retry delay after a failed request"`
+		BackoffMax    time.Duration `yaml:"backoff_max" envconfig:"GITEA_POLLER_BACKOFF_MAX" desc:"highest retry delay after failed requests"`
+		BackoffJitter float64       `yaml:"backoff_jitter" envconfig:"GITEA_POLLER_BACKOFF_JITTER" desc:"randomizes the retry delay by this fraction"`
+		// MaxJobs exits the daemon after this amount of completed tasks, 0 is unlimited
+		MaxJobs int `yaml:"max_jobs" envconfig:"GITEA_POLLER_MAX_JOBS" desc:"exit after completing this amount of jobs, 0 is unlimited"`
+		// IdleTimeout exits the daemon if no task has been running for this duration, 0 is unlimited
+		IdleTimeout time.Duration `yaml:"idle_timeout" envconfig:"GITEA_POLLER_IDLE_TIMEOUT" desc:"exit if no job has been running for this duration, 0 is unlimited"`
+		// DrainTimeout is the grace period for running tasks after a drain request, 0 waits forever
+		DrainTimeout time.Duration `yaml:"drain_timeout" envconfig:"GITEA_POLLER_DRAIN_TIMEOUT" desc:"grace period for running jobs after a drain request, 0 waits forever"`
+	}
+
+	// Runtime configures the actions runtime server started for each job
+	Runtime struct {
+		ListeningAddress    string `yaml:"listening_address" envconfig:"GITEA_ACTIONS_RUNNER_RUNTIME_LISTENING_ADDRESS" desc:"listening address of the runtime server"`
+		ExternalURL         string `yaml:"external_url" envconfig:"GITEA_ACTIONS_RUNNER_RUNTIME_EXTERNAL_URL" desc:"url of the runtime server used by the jobs, defaults to the hostname and the listening port"`
+		PreferredOutboundIP string `yaml:"preferred_outbound_ip" envconfig:"GITEA_ACTIONS_RUNNER_RUNTIME_PREFERRED_OUTBOUND_IP" desc:"ip address used as hostname instead of the detected outbound ip"`
+		Hostname            string `yaml:"hostname" envconfig:"GITEA_ACTIONS_RUNNER_RUNTIME_HOSTNAME" desc:"hostname of the runtime server"`
+		UseDNSName          Bool   `yaml:"use_dns_name" envconfig:"GITEA_ACTIONS_RUNNER_RUNTIME_USE_DNS_NAME" desc:"use the dns name of the outbound ip as hostname"`
+		AppendNoProxy       Bool   `yaml:"append_no_proxy" envconfig:"GITEA_ACTIONS_RUNNER_RUNTIME_APPEND_NO_PROXY" desc:"add the hostname to no_proxy"`
+	}
+
+	Cache struct {
+		// ServerURL disables the builtin cache server
+		ServerURL string `yaml:"server_url" envconfig:"GITEA_ACTIONS_CACHE_SERVER_URL" desc:"url of an external cache server, empty uses the builtin cache"`
+	}
+
+	Resources struct {
+		// Dirs are checked for free disk in addition to the working and cache directory
+		Dirs            []string `yaml:"dirs" envconfig:"GITEA_RESOURCES_DIRS" desc:"checked for free disk in addition to the working and cache directory"`
+		MinFreeDiskMB   uint64   `yaml:"min_free_disk_mb" envconfig:"GITEA_RESOURCES_MIN_FREE_DISK_MB" desc:"stop fetching jobs below this free disk"`
+		MinFreeMemoryMB uint64   `yaml:"min_free_memory_mb" envconfig:"GITEA_RESOURCES_MIN_FREE_MEMORY_MB" desc:"stop fetching jobs below this available memory (linux only)"`
+		MaxLoad         float64  `yaml:"max_load" envconfig:"GITEA_RESOURCES_MAX_LOAD" desc:"stop fetching jobs above this 1 minute load average (linux only)"`
+		CleanupCommand  string   `yaml:"cleanup_command" envconfig:"GITEA_RESOURCES_CLEANUP_COMMAND" desc:"shell command executed once a threshold is breached"`
+	}
+
+	Metrics struct {
+		// Addr is the listening address of the prometheus /metrics endpoint, empty disables it
+		Addr string `yaml:"addr" envconfig:"GITEA_METRICS_ADDR" desc:"listening address of the prometheus metrics, empty disables them"`
+	}
+
+	Control struct {
+		// Socket is the unix socket of the control api, empty disables it
+		Socket string `yaml:"socket" envconfig:"GITEA_CONTROL_SOCKET" desc:"unix socket used by the status, pause, resume and cancel commands, empty disables it"`
+	}
+
+	Update struct {
+		// Repository publishes the release binaries used by update --self
+		Repository string `yaml:"repository" envconfig:"GITEA_UPDATE_REPOSITORY" desc:"github repository of the runner releases used by update --self"`
+		// OnStart updates the binary to the latest release before the daemon starts
+		OnStart Bool `yaml:"on_start" envconfig:"GITEA_UPDATE_ON_START" desc:"update the runner binary to the latest release when the daemon starts"`
+	}
+
+	GC struct {
+		// OnStart removes stale runner versions, clone directories and caches before the daemon starts
+		OnStart        Bool          `yaml:"on_start" envconfig:"GITEA_GC_ON_START" desc:"remove stale runner versions, clone directories and cache entries when the daemon starts"`
+		CacheMaxAge    time.Duration `yaml:"cache_max_age" envconfig:"GITEA_GC_CACHE_MAX_AGE" desc:"remove cache entries written before this duration, 0 keeps them"`
+		CacheMaxSizeMB int64         `yaml:"cache_max_size_mb" envconfig:"GITEA_GC_CACHE_MAX_SIZE_MB" desc:"remove the oldest cache entries above this total size, 0 is unlimited"`
 	}
 
 	Platform struct {
-		OS   string `envconfig:"GITEA_PLATFORM_OS"`
-		Arch string `envconfig:"GITEA_PLATFORM_ARCH"`
+		OS   string `yaml:"os" envconfig:"GITEA_PLATFORM_OS" desc:"defaults to the os of the runner"`
+		Arch string `yaml:"arch" envconfig:"GITEA_PLATFORM_ARCH" desc:"defaults to the architecture of the runner"`
 	}
 )
 
+// Defaults returns the configuration without config file and environment
+func Defaults() Config {
+	return Config{
+		Runner: Runner{
+			File:                  ".runner",
+			JournalDir:            ".journal",
+			UnauthenticatedPolicy: UnauthenticatedExit,
+		},
+		Poller: Poller{
+			BackoffMin:    5 * time.Second,
+			BackoffMax:    5 * time.Minute,
+			BackoffJitter: 0.2,
+		},
+		Runtime: Runtime{
+			ListeningAddress: ":0",
+		},
+		Update: Update{
+			Repository: "ChristopherHX/gitea-actions-runner",
+		},
+	}
+}
+
 // FromEnviron returns the settings from the environment.
 func FromEnviron() (Config, error) {
-	cfg := Config{}
+	return Load("", "")
+}
+
+// FromEnvironFile returns the settings from the environment using the given runner file,
+// an empty file uses GITEA_RUNNER_FILE
+func FromEnvironFile(file string) (Config, error) {
+	return Load("", file)
+}
+
+// Load returns the settings of the config file overridden by the environment,
+// an empty configFile only uses the environment
+func Load(configFile, file string) (Config, error) {
+	cfg, err := LoadFile(configFile)
+	if err != nil {
+		return cfg, err
+	}
 	if err := envconfig.Process("", &cfg); err != nil {
 		return cfg, err
 	}
+	if file != "" {
+		cfg.Runner.File = file
+	}
 
 	// check runner config exist
 	if f, err := os.Stat(cfg.Runner.File); err == nil && !f.IsDir() {
@@ -98,7 +234,7 @@ func FromEnviron() (Config, error) {
 	}
 
 	// runner config
-	if cfg.Runner.Environ == nil {
+	if len(cfg.Runner.Environ) == 0 {
 		cfg.Runner.Environ = map[string]string{
 			"GITHUB_API_URL":    cfg.Client.Address + "/api/v1",
 			"GITHUB_SERVER_URL": cfg.Client.Address,
@@ -125,6 +261,21 @@ func FromEnviron() (Config, error) {
 			cfg.Runner.Environ[k] = v
 		}
 	}
+	for label, file := range cfg.Runner.LabelEnvFiles {
+		envs, err := godotenv.Read(file)
+		if err != nil {
+			return cfg, err
+		}
+		if cfg.Runner.LabelEnviron == nil {
+			cfg.Runner.LabelEnviron = map[string]map[string]string{}
+		}
+		if cfg.Runner.LabelEnviron[label] == nil {
+			cfg.Runner.LabelEnviron[label] = map[string]string{}
+		}
+		for k, v := range envs {
+			cfg.Runner.LabelEnviron[label][k] = v
+		}
+	}
 
-	return cfg, nil
+	return cfg, cfg.Validate()
 }
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("poller:\n  backoff_min: 10s\n  max_jobs: 3\nruntime:\n  use_dns_name: true\n"), 0o600))
+	t.Setenv("GITEA_POLLER_MAX_JOBS", "5")
+
+	cfg, err := Load(file, filepath.Join(dir, ".runner"))
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, cfg.Poller.BackoffMin)
+	assert.Equal(t, 5*time.Minute, cfg.Poller.BackoffMax)
+	assert.Equal(t, 5, cfg.Poller.MaxJobs)
+	assert.Equal(t, Bool(true), cfg.Runtime.UseDNSName)
+}
+
+func TestLoadFileUnknownKey(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("runner:\n  capcity: 2\n"), 0o600))
+
+	_, err := LoadFile(file)
+	assert.ErrorContains(t, err, "capcity")
+}
+
+func TestLoadTraceMessages(t *testing.T) {
+	t.Setenv("GITEA_RUNNER_TRACE", "yes")
+	cfg, err := Load("", filepath.Join(t.TempDir(), ".runner"))
+	assert.NoError(t, err)
+	assert.Equal(t, Bool(true), cfg.Log.Messages)
+}
+
+func TestValidateNegativeTimeouts(t *testing.T) {
+	cfg := Defaults()
+	cfg.Poller.IdleTimeout = -time.Second
+	cfg.Poller.DrainTimeout = -time.Second
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "poller.idle_timeout")
+	assert.ErrorContains(t, err, "poller.drain_timeout")
+}
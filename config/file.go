@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bool accepts 1, true, yes and y in environment variables
+type Bool bool
+
+// Decode implements envconfig.Decoder
+func (b *Bool) Decode(value string) error {
+	switch strings.ToLower(value) {
+	case "y", "yes":
+		*b = true
+		return nil
+	case "", "n", "no":
+		*b = false
+		return nil
+	}
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*b = Bool(v)
+	return nil
+}
+
+// LoadFile returns the defaults overridden by the yaml config file,
+// unknown keys are reported as error
+func LoadFile(configFile string) (Config, error) {
+	cfg := Defaults()
+	if configFile == "" {
+		return cfg, nil
+	}
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return cfg, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("%s: %w", configFile, err)
+	}
+	return cfg, nil
+}
+
+// Validate reports all invalid settings
+func (cfg Config) Validate() error {
+	var errs []error
+	switch cfg.Runner.UnauthenticatedPolicy {
+	case UnauthenticatedExit, UnauthenticatedReregister:
+	default:
+		errs = append(errs, fmt.Errorf("runner.unauthenticated_policy: invalid value %q, expected %s or %s",
+			cfg.Runner.UnauthenticatedPolicy, UnauthenticatedExit, UnauthenticatedReregister))
+	}
+	if cfg.Runner.Capacity < 0 {
+		errs = append(errs, fmt.Errorf("runner.capacity: must not be negative"))
+	}
+	if cfg.Runner.File == "" {
+		errs = append(errs, fmt.Errorf("runner.file: must not be empty"))
+	}
+	if cfg.Poller.BackoffMin <= 0 {
+		errs = append(errs, fmt.Errorf("poller.backoff_min: must be positive"))
+	}
+	if cfg.Poller.BackoffMax < cfg.Poller.BackoffMin {
+		errs = append(errs, fmt.Errorf("poller.backoff_max: must not be lower than poller.backoff_min"))
+	}
+	if cfg.Poller.BackoffJitter < 0 || cfg.Poller.BackoffJitter > 1 {
+		errs = append(errs, fmt.Errorf("poller.backoff_jitter: must be between 0 and 1"))
+	}
+	if cfg.Poller.MaxJobs < 0 {
+		errs = append(errs, fmt.Errorf("poller.max_jobs: must not be negative"))
+	}
+	if cfg.Poller.IdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("poller.idle_timeout: must not be negative"))
+	}
+	if cfg.Poller.DrainTimeout < 0 {
+		errs = append(errs, fmt.Errorf("poller.drain_timeout: must not be negative"))
+	}
+	if addr := cfg.Runtime.ListeningAddress; addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs = append(errs, fmt.Errorf("runtime.listening_address: %w", err))
+		}
+	}
+	if ip := cfg.Runtime.PreferredOutboundIP; ip != "" && net.ParseIP(ip) == nil {
+		errs = append(errs, fmt.Errorf("runtime.preferred_outbound_ip: invalid ip %q", ip))
+	}
+	if err := validateURL(cfg.Runtime.ExternalURL); err != nil {
+		errs = append(errs, fmt.Errorf("runtime.external_url: %w", err))
+	}
+	if err := validateURL(cfg.Cache.ServerURL); err != nil {
+		errs = append(errs, fmt.Errorf("cache.server_url: %w", err))
+	}
+	if cfg.Metrics.Addr != "" {
+		if _, _, err := net.SplitHostPort(cfg.Metrics.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("metrics.addr: %w", err))
+		}
+	}
+	if cfg.Resources.MaxLoad < 0 {
+		errs = append(errs, fmt.Errorf("resources.max_load: must not be negative"))
+	}
+	if cfg.GC.CacheMaxAge < 0 {
+		errs = append(errs, fmt.Errorf("gc.cache_max_age: must not be negative"))
+	}
+	if cfg.GC.CacheMaxSizeMB < 0 {
+		errs = append(errs, fmt.Errorf("gc.cache_max_size_mb: must not be negative"))
+	}
+	if owner, name, ok := strings.Cut(cfg.Update.Repository, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		errs = append(errs, fmt.Errorf("update.repository: invalid repository %q, expected owner/name", cfg.Update.Repository))
+	}
+	return errors.Join(errs...)
+}
+
+func validateURL(u string) error {
+	if u == "" {
+		return nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid url %q, expected http or https", u)
+	}
+	return nil
+}
+
+// Generate writes the config as yaml, the keys are documented with their description and environment variable
+func Generate(w io.Writer, cfg Config) error {
+	node, err := documentedNode(reflect.ValueOf(cfg))
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func documentedNode(v reflect.Value) (*yaml.Node, error) {
+	if v.Kind() != reflect.Struct {
+		node := &yaml.Node{}
+		if err := node.Encode(v.Interface()); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		value, err := documentedNode(v.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		comment := field.Tag.Get("desc")
+		if env := field.Tag.Get("envconfig"); env != "" {
+			comment = strings.TrimSpace(fmt.Sprintf("%s\nenv: %s", comment, env))
+		}
+		node.Content = append(node.Content, &yaml.Node{
+			Kind:        yaml.ScalarNode,
+			Value:       name,
+			HeadComment: comment,
+		}, value)
+	}
+	return node, nil
+}
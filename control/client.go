@@ -0,0 +1,80 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Client calls the control api of a running daemon
+type Client struct {
+	http *http.Client
+}
+
+// NewClient connects to the unix socket of the daemon
+func NewClient(socket string) *Client {
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Status returns the state of the daemon and its running tasks
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	return c.do(ctx, http.MethodGet, "/status")
+}
+
+// Pause stops fetching new tasks
+func (c *Client) Pause(ctx context.Context) (*Status, error) {
+	return c.do(ctx, http.MethodPost, "/pause")
+}
+
+// Resume fetches tasks again
+func (c *Client) Resume(ctx context.Context) (*Status, error) {
+	return c.do(ctx, http.MethodPost, "/resume")
+}
+
+// Cancel cancels a running task
+func (c *Client) Cancel(ctx context.Context, id int64) error {
+	_, err := c.do(ctx, http.MethodPost, fmt.Sprintf("/tasks/%d/cancel", id))
+	return err
+}
+
+func (c *Client) do(ctx context.Context, method, path string) (*Status, error) {
+	// the host is ignored by the unix socket transport
+	req, err := http.NewRequestWithContext(ctx, method, "http://daemon"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		var e errorResponse
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("%s", e.Error)
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	status := &Status{}
+	if err := json.Unmarshal(body, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
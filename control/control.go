@@ -0,0 +1,119 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ChristopherHX/gitea-actions-runner/runtime"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Status is the state of the daemon
+type Status struct {
+	Paused    bool                 `json:"paused"`
+	Capacity  int                  `json:"capacity"`
+	BusySlots int64                `json:"busy_slots"`
+	FreeSlots int64                `json:"free_slots"`
+	Tasks     []runtime.TaskStatus `json:"tasks"`
+}
+
+// Daemon is controlled via the socket
+type Daemon interface {
+	// Status returns the state without the running tasks
+	Status() Status
+	Pause()
+	Resume()
+}
+
+// Server serves the control api on a unix socket
+type Server struct {
+	Socket string
+	Daemon Daemon
+
+	server *http.Server
+}
+
+// Listen creates the socket, a stale socket of a crashed daemon is replaced
+func (s *Server) Listen() (net.Listener, error) {
+	if conn, err := net.Dial("unix", s.Socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is used by another daemon", s.Socket)
+	}
+	_ = os.Remove(s.Socket)
+	listener, err := net.Listen("unix", s.Socket)
+	if err != nil {
+		return nil, err
+	}
+	// only the user of the daemon is allowed to control it
+	if err := os.Chmod(s.Socket, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Serve handles requests until Shutdown
+func (s *Server) Serve(listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.status)
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		s.Daemon.Pause()
+		s.status(w, r)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		s.Daemon.Resume()
+		s.status(w, r)
+	})
+	mux.HandleFunc("POST /tasks/{id}/cancel", s.cancel)
+	s.server = &http.Server{Handler: mux}
+	err := s.server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the server and removes the socket
+func (s *Server) Shutdown(ctx context.Context) {
+	if s.server != nil {
+		_ = s.server.Shutdown(ctx)
+	}
+	_ = os.Remove(s.Socket)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	status := s.Daemon.Status()
+	status.Tasks = runtime.RunningTasks()
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) cancel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid task id"})
+		return
+	}
+	if !runtime.CancelTask(id) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: fmt.Sprintf("task %d is not running", id)})
+		return
+	}
+	log.Infof("control: cancelling task %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
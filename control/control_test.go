@@ -0,0 +1,50 @@
+package control
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDaemon struct {
+	paused bool
+}
+
+func (d *fakeDaemon) Status() Status {
+	return Status{Paused: d.paused, Capacity: 2, FreeSlots: 2}
+}
+
+func (d *fakeDaemon) Pause() {
+	d.paused = true
+}
+
+func (d *fakeDaemon) Resume() {
+	d.paused = false
+}
+
+func TestServer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "runner.sock")
+	server := &Server{Socket: socket, Daemon: &fakeDaemon{}}
+	listener, err := server.Listen()
+	assert.NoError(t, err)
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	cli := NewClient(socket)
+	status, err := cli.Pause(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, status.Paused)
+	assert.Equal(t, 2, status.Capacity)
+	assert.Empty(t, status.Tasks)
+
+	status, err = cli.Resume(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, status.Paused)
+
+	assert.ErrorContains(t, cli.Cancel(context.Background(), 42), "task 42 is not running")
+
+	_, err = server.Listen()
+	assert.ErrorContains(t, err, "used by another daemon")
+}
@@ -0,0 +1,133 @@
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+// eventContext fills event, event_name, ref and sha of the github context like gitea does,
+// values of the context file take precedence over values derived from the event payload
+func eventContext(githubContext map[string]any, workflow []byte, opts Options) error {
+	eventName := opts.EventName
+	if eventName == "" {
+		eventName, _ = githubContext["event_name"].(string)
+	}
+	if eventName == "" {
+		eventName = "push"
+		if len(opts.Inputs) > 0 {
+			eventName = "workflow_dispatch"
+		}
+	}
+	githubContext["event_name"] = eventName
+
+	event := opts.Event
+	if event == nil {
+		event, _ = githubContext["event"].(map[string]any)
+	}
+	if event == nil {
+		event = map[string]any{}
+	}
+	if eventName == "workflow_dispatch" {
+		inputs, err := dispatchInputs(workflow, event, opts.Inputs)
+		if err != nil {
+			return err
+		}
+		event["inputs"] = inputs
+	} else if len(opts.Inputs) > 0 {
+		return fmt.Errorf("inputs require the workflow_dispatch event, got %s", eventName)
+	}
+	githubContext["event"] = event
+
+	setDefault := func(key, value string) {
+		if _, ok := githubContext[key]; !ok && value != "" {
+			githubContext[key] = value
+		}
+	}
+	ref, sha := "", ""
+	switch eventName {
+	case "pull_request", "pull_request_target":
+		pr, _ := event["pull_request"].(map[string]any)
+		head, _ := pr["head"].(map[string]any)
+		base, _ := pr["base"].(map[string]any)
+		headRef, _ := head["ref"].(string)
+		baseRef, _ := base["ref"].(string)
+		setDefault("head_ref", headRef)
+		setDefault("base_ref", baseRef)
+		if eventName == "pull_request_target" {
+			ref = "refs/heads/" + baseRef
+			sha, _ = base["sha"].(string)
+		} else {
+			if number, ok := event["number"]; ok {
+				ref = fmt.Sprintf("refs/pull/%v/head", number)
+			}
+			sha, _ = head["sha"].(string)
+		}
+	default:
+		ref, _ = event["ref"].(string)
+		sha, _ = event["after"].(string)
+		if sha == "" {
+			sha, _ = event["sha"].(string)
+		}
+	}
+	setDefault("ref", ref)
+	setDefault("sha", sha)
+
+	ref, _ = githubContext["ref"].(string)
+	switch {
+	case strings.HasPrefix(ref, "refs/tags/"):
+		setDefault("ref_name", strings.TrimPrefix(ref, "refs/tags/"))
+		setDefault("ref_type", "tag")
+	case strings.HasPrefix(ref, "refs/heads/"):
+		setDefault("ref_name", strings.TrimPrefix(ref, "refs/heads/"))
+		setDefault("ref_type", "branch")
+	case strings.HasPrefix(ref, "refs/pull/"):
+		setDefault("ref_name", strings.TrimPrefix(ref, "refs/pull/"))
+	}
+	return nil
+}
+
+// dispatchInputs returns the inputs of the event with the defaults of the workflow_dispatch trigger,
+// values stay strings, Task.Run restores the boolean inputs
+func dispatchInputs(workflow []byte, event map[string]any, values map[string]string) (map[string]any, error) {
+	inputs := map[string]any{}
+	if existing, ok := event["inputs"].(map[string]any); ok {
+		for k, v := range existing {
+			inputs[k] = v
+		}
+	}
+	w, err := model.ReadWorkflow(bytes.NewReader(workflow))
+	if err != nil {
+		return nil, err
+	}
+	config := w.WorkflowDispatchConfig()
+	if config == nil {
+		if len(values) > 0 {
+			return nil, fmt.Errorf("the workflow has no workflow_dispatch trigger")
+		}
+		return inputs, nil
+	}
+	for k, input := range config.Inputs {
+		if _, ok := inputs[k]; !ok && input.Default != "" {
+			inputs[k] = input.Default
+		}
+	}
+	for k, v := range values {
+		input, ok := config.Inputs[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown input %s", k)
+		}
+		if input.Type == "boolean" && v != "true" && v != "false" {
+			return nil, fmt.Errorf("input %s: expected true or false, got %q", k, v)
+		}
+		inputs[k] = v
+	}
+	for k, input := range config.Inputs {
+		if _, ok := inputs[k]; !ok && input.Required {
+			return nil, fmt.Errorf("input %s is required", k)
+		}
+	}
+	return inputs, nil
+}
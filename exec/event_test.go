@@ -0,0 +1,73 @@
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dispatchWorkflow = `
+on:
+  workflow_dispatch:
+    inputs:
+      debug:
+        type: boolean
+        default: "false"
+      name:
+        required: true
+jobs:
+  test:
+    runs-on: self-hosted
+    steps:
+    - run: echo ${{ inputs.name }}
+`
+
+func TestEventContextTagPush(t *testing.T) {
+	githubContext := map[string]any{}
+	err := eventContext(githubContext, []byte(testWorkflow), Options{
+		Event: map[string]any{"ref": "refs/tags/v1.0.0", "after": "abc"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "push", githubContext["event_name"])
+	assert.Equal(t, "refs/tags/v1.0.0", githubContext["ref"])
+	assert.Equal(t, "abc", githubContext["sha"])
+	assert.Equal(t, "v1.0.0", githubContext["ref_name"])
+	assert.Equal(t, "tag", githubContext["ref_type"])
+}
+
+func TestEventContextPullRequest(t *testing.T) {
+	githubContext := map[string]any{"sha": "fixed"}
+	err := eventContext(githubContext, []byte(testWorkflow), Options{
+		EventName: "pull_request",
+		Event: map[string]any{
+			"number": float64(5),
+			"pull_request": map[string]any{
+				"head": map[string]any{"ref": "feature", "sha": "def"},
+				"base": map[string]any{"ref": "main"},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/pull/5/head", githubContext["ref"])
+	assert.Equal(t, "fixed", githubContext["sha"])
+	assert.Equal(t, "feature", githubContext["head_ref"])
+	assert.Equal(t, "main", githubContext["base_ref"])
+}
+
+func TestEventContextInputs(t *testing.T) {
+	githubContext := map[string]any{}
+	err := eventContext(githubContext, []byte(dispatchWorkflow), Options{
+		Inputs: map[string]string{"name": "world"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "workflow_dispatch", githubContext["event_name"])
+	event := githubContext["event"].(map[string]any)
+	assert.Equal(t, map[string]any{"debug": "false", "name": "world"}, event["inputs"])
+
+	err = eventContext(map[string]any{}, []byte(dispatchWorkflow), Options{Inputs: map[string]string{"debug": "yes", "name": "world"}})
+	assert.Error(t, err)
+	err = eventContext(map[string]any{}, []byte(dispatchWorkflow), Options{EventName: "workflow_dispatch"})
+	assert.ErrorContains(t, err, "required")
+	err = eventContext(map[string]any{}, []byte(testWorkflow), Options{Inputs: map[string]string{"name": "world"}})
+	assert.Error(t, err)
+}
@@ -2,17 +2,55 @@ package exec
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	pingv1 "code.gitea.io/actions-proto-go/ping/v1"
 	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
 	"connectrpc.com/connect"
+	"github.com/ChristopherHX/gitea-actions-runner/config"
 	"github.com/ChristopherHX/gitea-actions-runner/runtime"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 	structpb "google.golang.org/protobuf/types/known/structpb"
-	"gopkg.in/yaml.v3"
 )
 
-type mockClient struct{}
+// logWriter serializes the log lines of concurrent runs
+type logWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *logWriter) Println(name, line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "[%s] %s\n", name, line)
+}
+
+// mockClient prints the logs of a run and records its final state
+type mockClient struct {
+	name string
+	log  *logWriter
+
+	mu      sync.Mutex
+	state   *runnerv1.TaskState
+	outputs map[string]string
+}
+
+// State returns the final state and the job outputs of the run
+func (m *mockClient) State() (*runnerv1.TaskState, map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, m.outputs
+}
 
 // Address implements client.Client.
 func (m *mockClient) Address() string {
@@ -56,7 +94,7 @@ func (m *mockClient) Register(context.Context, *connect.Request[runnerv1.Registe
 // UpdateLog implements client.Client.
 func (m *mockClient) UpdateLog(_ context.Context, req *connect.Request[runnerv1.UpdateLogRequest]) (*connect.Response[runnerv1.UpdateLogResponse], error) {
 	for _, row := range req.Msg.Rows {
-		fmt.Println(row.Content)
+		m.log.Println(m.name, row.Content)
 	}
 	return connect.NewResponse(&runnerv1.UpdateLogResponse{
 		AckIndex: req.Msg.Index + int64(len(req.Msg.Rows)),
@@ -66,17 +104,220 @@ func (m *mockClient) UpdateLog(_ context.Context, req *connect.Request[runnerv1.
 // UpdateTask implements client.Client.
 func (m *mockClient) UpdateTask(_ context.Context, req *connect.Request[runnerv1.UpdateTaskRequest]) (*connect.Response[runnerv1.UpdateTaskResponse], error) {
 	if req.Msg.State.Result != runnerv1.Result_RESULT_UNSPECIFIED {
-		fmt.Println("Task completed with result:", req.Msg.State.Result)
+		m.log.Println(m.name, fmt.Sprintf("Task completed with result: %v", req.Msg.State.Result))
+		m.mu.Lock()
+		m.state = req.Msg.State
+		m.outputs = req.Msg.Outputs
+		m.mu.Unlock()
 	}
 	return connect.NewResponse(&runnerv1.UpdateTaskResponse{
 		State: req.Msg.State,
 	}), nil
 }
 
-func Exec(ctx context.Context, content, contextData, varsData, secretsData string, args []string) error {
-	mapData := make(map[string]any)
-	yaml.Unmarshal([]byte(contextData), &mapData)
-	if len(mapData) == 0 {
+// Options of a local workflow run
+type Options struct {
+	// Workflow is the content of the workflow file
+	Workflow []byte
+	// Context is the github context, defaults are derived from the event
+	Context   map[string]any
+	EventName string
+	Event     map[string]any
+	// Inputs are the workflow_dispatch inputs
+	Inputs  map[string]string
+	Secrets map[string]string
+	Vars    map[string]string
+	// Env is added to the environment of every job
+	Env map[string]string
+	// Jobs limits the run to the given jobs and the jobs they need
+	Jobs   []string
+	Worker []string
+	// Log receives the log lines of all jobs, defaults to stdout
+	Log io.Writer
+}
+
+// Exec runs the jobs of the workflow in the order of their needs,
+// the error reports runs that failed to start or to report their result
+func Exec(ctx context.Context, cfg config.Config, opts Options) (*Result, error) {
+	mapData, err := githubContext(opts)
+	if err != nil {
+		return nil, err
+	}
+	planned, err := planWorkflow(opts.Workflow, opts.Jobs)
+	if err != nil {
+		return nil, err
+	}
+	logs := &logWriter{w: opts.Log}
+	if logs.w == nil {
+		logs.w = os.Stdout
+	}
+
+	var (
+		taskID atomic.Int64
+		mu     sync.Mutex
+		errs   []error
+		wg     sync.WaitGroup
+	)
+	needs := map[string]*runnerv1.TaskNeed{}
+	done := map[string]chan struct{}{}
+	for _, job := range planned {
+		done[job.ID] = make(chan struct{})
+	}
+	// concurrent workers share the runner directory unless the worker creates a clone for each job
+	exclusive := make(chan struct{}, 1)
+	parallel := cloneableWorker(opts.Worker)
+	if !parallel {
+		log.Debug("the worker cannot be cloned, running the jobs one at a time")
+	}
+	clients := make([][]*mockClient, len(planned))
+	runErrs := make([][]error, len(planned))
+	for i, job := range planned {
+		clients[i] = make([]*mockClient, len(job.Runs))
+		runErrs[i] = make([]error, len(job.Runs))
+	}
+	for j, job := range planned {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[job.ID])
+			jobNeeds := map[string]*runnerv1.TaskNeed{}
+			for _, need := range job.Needs {
+				<-done[need]
+				mu.Lock()
+				jobNeeds[need] = needs[need]
+				mu.Unlock()
+			}
+
+			// strategy.max-parallel limits the concurrent matrix combinations
+			slots := make(chan struct{}, job.MaxParallel)
+			var runs sync.WaitGroup
+			for i, run := range job.Runs {
+				slots <- struct{}{}
+				clients[j][i] = &mockClient{name: run.Name, log: logs}
+				runs.Add(1)
+				go func() {
+					defer runs.Done()
+					defer func() { <-slots }()
+					if !parallel {
+						exclusive <- struct{}{}
+						defer func() { <-exclusive }()
+					}
+					pContext, _ := structpb.NewStruct(mapData)
+					err := runTask(ctx, cfg, opts, clients[j][i], &runnerv1.Task{
+						Id:              taskID.Add(1),
+						WorkflowPayload: run.Payload,
+						Context:         pContext,
+						Secrets:         opts.Secrets,
+						Vars:            opts.Vars,
+						Needs:           jobNeeds,
+					})
+					if err != nil {
+						runErrs[j][i] = err
+						mu.Lock()
+						errs = append(errs, fmt.Errorf("%s: %w", run.Name, err))
+						mu.Unlock()
+					}
+				}()
+			}
+			runs.Wait()
+
+			need := jobNeed(clients[j])
+			log.Infof("job %s completed with result %v", job.ID, need.Result)
+			mu.Lock()
+			needs[job.ID] = need
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	result := &Result{Jobs: []JobResult{}}
+	combined := runnerv1.Result_RESULT_SKIPPED
+	for j, job := range planned {
+		for i, run := range job.Runs {
+			state, outputs := clients[j][i].State()
+			jr := jobResult(job.ID, run, state, outputs, runErrs[j][i])
+			if state != nil && state.Result != runnerv1.Result_RESULT_UNSPECIFIED {
+				combined = worseResult(combined, state.Result)
+			} else {
+				combined = worseResult(combined, runnerv1.Result_RESULT_FAILURE)
+			}
+			result.Jobs = append(result.Jobs, jr)
+		}
+	}
+	result.Result = resultName(combined)
+	return result, errors.Join(errs...)
+}
+
+// Replay runs a recorded task, the secrets and vars of the options replace the recorded values
+func Replay(ctx context.Context, cfg config.Config, task *runnerv1.Task, opts Options) (*Result, error) {
+	task = proto.Clone(task).(*runnerv1.Task)
+	if task.Secrets == nil {
+		task.Secrets = map[string]string{}
+	}
+	if task.Vars == nil {
+		task.Vars = map[string]string{}
+	}
+	if task.Context == nil {
+		task.Context = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	}
+	maps.Copy(task.Secrets, opts.Secrets)
+	maps.Copy(task.Vars, opts.Vars)
+	for k, v := range task.Secrets {
+		if v == runtime.SecretPlaceholder {
+			log.Warnf("secret %s has not been recorded, pass it via --secret or --secrets-file", k)
+		}
+	}
+	planned, err := planWorkflow(task.WorkflowPayload, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(planned) != 1 || len(planned[0].Runs) != 1 {
+		return nil, fmt.Errorf("the recorded task has to contain a single job")
+	}
+	run := planned[0].Runs[0]
+	// the recorded payload is run unchanged, gitea already added the matrix values to the name
+	run.Name = planned[0].Name
+	run.Payload = task.WorkflowPayload
+	logs := &logWriter{w: opts.Log}
+	if logs.w == nil {
+		logs.w = os.Stdout
+	}
+	client := &mockClient{name: run.Name, log: logs}
+	runErr := runTask(ctx, cfg, opts, client, task)
+	state, outputs := client.State()
+	job := jobResult(planned[0].ID, run, state, outputs, runErr)
+	return &Result{Result: job.Result, Jobs: []JobResult{job}}, runErr
+}
+
+// runTask runs a single job task with the mock client
+func runTask(ctx context.Context, cfg config.Config, opts Options, client *mockClient, task *runnerv1.Task) error {
+	t := runtime.NewTask("gitea", 0, client, opts.Env, nil)
+	t.Runtime = cfg.Runtime
+	t.Cache = cfg.Cache
+	t.Log = cfg.Log
+	return t.Run(ctx, task, slices.Clone(opts.Worker))
+}
+
+// cloneableWorker reports whether the worker args allow concurrent jobs,
+// which requires --allow-clone, --runner-dir and --max-parallel above 1
+func cloneableWorker(worker []string) bool {
+	options := map[string]string{}
+	for _, arg := range worker {
+		if !strings.HasPrefix(arg, "--") {
+			break
+		}
+		k, v, _ := strings.Cut(arg, "=")
+		options[k] = v
+	}
+	allowClone, ok := options["--allow-clone"]
+	maxParallel, _ := strconv.Atoi(options["--max-parallel"])
+	return ok && allowClone == "" && options["--runner-dir"] != "" && maxParallel > 1
+}
+
+// githubContext returns the context of the options with the defaults of a local run
+func githubContext(opts Options) (map[string]any, error) {
+	mapData := maps.Clone(opts.Context)
+	if mapData == nil {
 		mapData = map[string]any{}
 	}
 	if mapData["gitea_runtime_token"] == nil {
@@ -85,18 +326,27 @@ func Exec(ctx context.Context, content, contextData, varsData, secretsData strin
 	if mapData["repository"] == nil {
 		mapData["repository"] = "test/test"
 	}
-	secrets := make(map[string]string)
-	vars := make(map[string]string)
-	yaml.Unmarshal([]byte(secretsData), &secrets)
-	yaml.Unmarshal([]byte(varsData), &vars)
-
-	pContext, _ := structpb.NewStruct(mapData)
-	task := runtime.NewTask("gitea", 0, &mockClient{}, nil, nil)
-	return task.Run(ctx, &runnerv1.Task{
-		Id:              1,
-		WorkflowPayload: []byte(content),
-		Context:         pContext,
-		Secrets:         secrets,
-		Vars:            vars,
-	}, args)
+	if err := eventContext(mapData, opts.Workflow, opts); err != nil {
+		return nil, err
+	}
+	if _, err := structpb.NewStruct(mapData); err != nil {
+		return nil, fmt.Errorf("invalid context: %w", err)
+	}
+	return mapData, nil
+}
+
+// jobNeed combines the results of the matrix combinations,
+// a run without result failed before reporting
+func jobNeed(clients []*mockClient) *runnerv1.TaskNeed {
+	need := &runnerv1.TaskNeed{Result: runnerv1.Result_RESULT_SKIPPED, Outputs: map[string]string{}}
+	for _, client := range clients {
+		state, outputs := client.State()
+		result := runnerv1.Result_RESULT_FAILURE
+		if state != nil && state.Result != runnerv1.Result_RESULT_UNSPECIFIED {
+			result = state.Result
+		}
+		need.Result = worseResult(need.Result, result)
+		maps.Copy(need.Outputs, outputs)
+	}
+	return need
 }
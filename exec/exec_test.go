@@ -0,0 +1,16 @@
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneableWorker(t *testing.T) {
+	assert.False(t, cloneableWorker([]string{"python3", "actions-runner-worker.py", "actions-runner/bin/Runner.Worker"}))
+	assert.False(t, cloneableWorker([]string{"--allow-clone", "--runner-dir=actions-runner", "python3"}))
+	assert.False(t, cloneableWorker([]string{"--max-parallel=4", "--runner-dir=actions-runner", "python3"}))
+	assert.True(t, cloneableWorker([]string{"--max-parallel=4", "--allow-clone", "--runner-dir=actions-runner", "python3"}))
+	// options after the interpreter are args of the worker
+	assert.False(t, cloneableWorker([]string{"python3", "--max-parallel=4", "--allow-clone", "--runner-dir=actions-runner"}))
+}
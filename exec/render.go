@@ -0,0 +1,182 @@
+package exec
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/ChristopherHX/gitea-actions-runner/runtime"
+	"github.com/ChristopherHX/github-act-runner/protocol"
+	log "github.com/sirupsen/logrus"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+const redacted = "***"
+
+// Render builds the job request of every job without opening a listener or starting a worker,
+// needed jobs are assumed to succeed without outputs and skipped jobs are null.
+// Secrets are redacted and generated ids are replaced, so the json can be compared with a golden file
+func Render(ctx context.Context, cfg config.Config, opts Options) ([]byte, error) {
+	mapData, err := githubContext(opts)
+	if err != nil {
+		return nil, err
+	}
+	planned, err := planWorkflow(opts.Workflow, opts.Jobs)
+	if err != nil {
+		return nil, err
+	}
+	messages := map[string]*protocol.AgentJobRequestMessage{}
+	var taskID int64
+	for _, job := range planned {
+		needs := map[string]*runnerv1.TaskNeed{}
+		for _, need := range job.Needs {
+			needs[need] = &runnerv1.TaskNeed{Result: runnerv1.Result_RESULT_SUCCESS, Outputs: map[string]string{}}
+		}
+		for _, run := range job.Runs {
+			taskID++
+			pContext, _ := structpb.NewStruct(mapData)
+			task := runtime.NewTask("gitea", 0, &mockClient{name: run.Name, log: &logWriter{w: io.Discard}}, opts.Env, nil)
+			task.Runtime = cfg.Runtime
+			task.Cache = cfg.Cache
+			task.Log = cfg.Log
+			task.Render = func(message *protocol.AgentJobRequestMessage) error {
+				normalizeRequest(message, cfg.Runtime.ExternalURL == "")
+				messages[run.Name] = message
+				return nil
+			}
+			err := task.Run(ctx, &runnerv1.Task{
+				Id:              taskID,
+				WorkflowPayload: run.Payload,
+				Context:         pContext,
+				Secrets:         opts.Secrets,
+				Vars:            opts.Vars,
+				Needs:           needs,
+			}, opts.Worker)
+			if errors.Is(err, runtime.ErrJobSkipped) {
+				log.Infof("%s: %v", run.Name, err)
+				messages[run.Name] = nil
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %w", run.Name, err)
+			}
+		}
+	}
+	out, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// normalizeRequest redacts the secrets, replaces the generated ids and sorts the maps,
+// the runtime url depends on the host if no external url is configured
+func normalizeRequest(message *protocol.AgentJobRequestMessage, hostURL bool) {
+	id := 0
+	nextID := func() string {
+		id++
+		return fmt.Sprintf("00000000-0000-0000-0000-%012d", id)
+	}
+	message.Plan.ScopeIdentifier = nextID()
+	message.Plan.PlanID = nextID()
+	message.Timeline.ID = nextID()
+	message.JobID = nextID()
+	for i := range message.Steps {
+		message.Steps[i].Id = nextID()
+	}
+	for k, v := range message.Variables {
+		if v.IsSecret {
+			v.Value = redacted
+			message.Variables[k] = v
+		}
+	}
+	for i, endpoint := range message.Resources.Endpoints {
+		if _, ok := endpoint.Authorization.Parameters["AccessToken"]; ok {
+			endpoint.Authorization.Parameters["AccessToken"] = redacted
+		}
+		if hostURL {
+			message.Resources.Endpoints[i].URL = "http://runtime/"
+		}
+	}
+	for k, data := range message.ContextData {
+		sortContextData(&data)
+		message.ContextData[k] = data
+	}
+	tokens := []*protocol.TemplateToken{message.JobContainer, message.JobServiceContainers, message.JobOutputs}
+	for i := range message.EnvironmentVariables {
+		tokens = append(tokens, &message.EnvironmentVariables[i])
+	}
+	for i := range message.Defaults {
+		tokens = append(tokens, &message.Defaults[i])
+	}
+	for _, step := range message.Steps {
+		tokens = append(tokens, step.Inputs, step.Environment)
+	}
+	for _, token := range tokens {
+		sortTemplateToken(token)
+	}
+	if github, ok := message.ContextData["github"]; ok && github.DictionaryValue != nil {
+		for i, pair := range *github.DictionaryValue {
+			switch pair.Key {
+			case "token", "gitea_runtime_token":
+				value := redacted
+				(*github.DictionaryValue)[i].Value.StringValue = &value
+			}
+		}
+	}
+}
+
+// sortContextData sorts dictionaries by key, they are created from go maps in random order
+func sortContextData(data *protocol.PipelineContextData) {
+	if data.ArrayValue != nil {
+		for i := range *data.ArrayValue {
+			sortContextData(&(*data.ArrayValue)[i])
+		}
+	}
+	if data.DictionaryValue != nil {
+		pairs := *data.DictionaryValue
+		slices.SortStableFunc(pairs, func(a, b protocol.DictionaryContextDataPair) int {
+			return cmp.Compare(a.Key, b.Key)
+		})
+		for i := range pairs {
+			sortContextData(&pairs[i].Value)
+		}
+	}
+}
+
+// sortTemplateToken sorts mappings by key like sortContextData
+func sortTemplateToken(token *protocol.TemplateToken) {
+	if token == nil {
+		return
+	}
+	if token.Seq != nil {
+		for i := range *token.Seq {
+			sortTemplateToken(&(*token.Seq)[i])
+		}
+	}
+	if token.Map != nil {
+		entries := *token.Map
+		key := func(entry protocol.MapEntry) string {
+			if entry.Key == nil {
+				return ""
+			}
+			if entry.Key.Lit != nil {
+				return *entry.Key.Lit
+			}
+			if entry.Key.Expr != nil {
+				return *entry.Key.Expr
+			}
+			return ""
+		}
+		slices.SortStableFunc(entries, func(a, b protocol.MapEntry) int {
+			return cmp.Compare(key(a), key(b))
+		})
+		for _, entry := range entries {
+			sortTemplateToken(entry.Value)
+		}
+	}
+}
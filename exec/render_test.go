@@ -0,0 +1,70 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	opts := Options{
+		Workflow: []byte(`
+on: push
+env:
+  TOKEN: ${{ secrets.TOKEN }}
+jobs:
+  build:
+    runs-on: self-hosted
+    steps:
+    - run: echo build
+      env:
+        B: b
+        A: a
+  deploy:
+    needs: build
+    if: needs.build.result == 'failure'
+    runs-on: self-hosted
+    steps:
+    - run: echo deploy
+`),
+		Secrets: map[string]string{"TOKEN": "top-secret"},
+	}
+	rendered, err := Render(context.Background(), config.Defaults(), opts)
+	assert.NoError(t, err)
+	again, err := Render(context.Background(), config.Defaults(), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, string(rendered), string(again))
+	assert.NotContains(t, string(rendered), "top-secret")
+	assert.NotContains(t, string(rendered), "1234567890abcdef")
+
+	messages := map[string]json.RawMessage{}
+	assert.NoError(t, json.Unmarshal(rendered, &messages))
+	assert.Contains(t, string(messages["build"]), "echo build")
+	assert.Equal(t, "null", string(messages["deploy"]))
+}
+
+func TestRenderEnvironmentUnchanged(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Runtime.AppendNoProxy = true
+	cfg.Runtime.UseDNSName = true
+	t.Setenv("no_proxy", "example.com")
+	t.Setenv("NO_PROXY", "example.com")
+	environ := os.Environ()
+	_, err := Render(context.Background(), cfg, Options{
+		Workflow: []byte(`
+on: push
+jobs:
+  build:
+    runs-on: self-hosted
+    steps:
+    - run: echo build
+`),
+	})
+	assert.NoError(t, err)
+	// rendering must not leak into the environment of the daemon
+	assert.Equal(t, environ, os.Environ())
+}
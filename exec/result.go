@@ -0,0 +1,216 @@
+package exec
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Result is the final state of a local workflow run
+type Result struct {
+	Result string      `json:"result"`
+	Jobs   []JobResult `json:"jobs"`
+}
+
+// JobResult is the final state of a job or of a matrix combination
+type JobResult struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Result    string            `json:"result"`
+	StartedAt time.Time         `json:"started_at,omitzero"`
+	StoppedAt time.Time         `json:"stopped_at,omitzero"`
+	Steps     []StepResult      `json:"steps"`
+	Outputs   map[string]string `json:"outputs,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// StepResult is the final state of a step, the log range refers to the log of the job
+type StepResult struct {
+	Name      string    `json:"name"`
+	Result    string    `json:"result"`
+	StartedAt time.Time `json:"started_at,omitzero"`
+	StoppedAt time.Time `json:"stopped_at,omitzero"`
+	LogIndex  int64     `json:"log_index"`
+	LogLength int64     `json:"log_length"`
+}
+
+// Failed reports whether a job failed or has been cancelled
+func (r *Result) Failed() bool {
+	return r.Result == resultName(runnerv1.Result_RESULT_FAILURE) || r.Result == resultName(runnerv1.Result_RESULT_CANCELLED)
+}
+
+// Cancelled reports whether a job has been cancelled and none failed
+func (r *Result) Cancelled() bool {
+	return r.Result == resultName(runnerv1.Result_RESULT_CANCELLED)
+}
+
+// WriteJSON writes the result as indented json
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes a testsuite per job and a testcase per step
+func (r *Result) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{}
+	for _, job := range r.Jobs {
+		suite := junitTestSuite{Name: job.Name, Time: duration(job.StartedAt, job.StoppedAt)}
+		if !job.StartedAt.IsZero() {
+			suite.Timestamp = job.StartedAt.Format(time.RFC3339)
+		}
+		for _, step := range job.Steps {
+			testCase := junitTestCase{Name: step.Name, ClassName: job.Name, Time: duration(step.StartedAt, step.StoppedAt)}
+			switch step.Result {
+			case resultName(runnerv1.Result_RESULT_SUCCESS):
+			case resultName(runnerv1.Result_RESULT_SKIPPED):
+				testCase.Skipped = &struct{}{}
+				suite.Skipped++
+			default:
+				testCase.Failure = &junitFailure{Message: step.Result}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		// the job itself fails without a failed step if the worker does not start
+		switch {
+		case suite.Failures == 0 && (job.Result == resultName(runnerv1.Result_RESULT_FAILURE) || job.Result == resultName(runnerv1.Result_RESULT_CANCELLED)):
+			message := job.Error
+			if message == "" {
+				message = job.Result
+			}
+			suite.Cases = append(suite.Cases, junitTestCase{Name: job.Name, ClassName: job.Name, Failure: &junitFailure{Message: message}})
+			suite.Failures++
+		case len(suite.Cases) == 0 && job.Result == resultName(runnerv1.Result_RESULT_SKIPPED):
+			suite.Cases = append(suite.Cases, junitTestCase{Name: job.Name, ClassName: job.Name, Skipped: &struct{}{}})
+			suite.Skipped++
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		suites.Time += suite.Time
+		suites.Suites = append(suites.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// jobResult converts the final task state reported by the run
+func jobResult(id string, run jobRun, state *runnerv1.TaskState, outputs map[string]string, err error) JobResult {
+	job := JobResult{
+		ID:      id,
+		Name:    run.Name,
+		Result:  resultName(runnerv1.Result_RESULT_FAILURE),
+		Steps:   []StepResult{},
+		Outputs: outputs,
+	}
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if state == nil {
+		return job
+	}
+	job.Result = resultName(state.Result)
+	job.StartedAt = asTime(state.StartedAt)
+	job.StoppedAt = asTime(state.StoppedAt)
+	for _, step := range state.Steps {
+		name := fmt.Sprintf("step %d", step.Id)
+		if step.Id >= 0 && int(step.Id) < len(run.StepNames) {
+			name = run.StepNames[step.Id]
+		}
+		job.Steps = append(job.Steps, StepResult{
+			Name:      name,
+			Result:    resultName(step.Result),
+			StartedAt: asTime(step.StartedAt),
+			StoppedAt: asTime(step.StoppedAt),
+			LogIndex:  step.LogIndex,
+			LogLength: step.LogLength,
+		})
+	}
+	return job
+}
+
+// resultName returns the result like the needs context, for example success
+func resultName(result runnerv1.Result) string {
+	return strings.ToLower(strings.TrimPrefix(result.String(), "RESULT_"))
+}
+
+// worseResult returns the result that decides the combined result
+func worseResult(a, b runnerv1.Result) runnerv1.Result {
+	rank := func(result runnerv1.Result) int {
+		switch result {
+		case runnerv1.Result_RESULT_SKIPPED:
+			return 0
+		case runnerv1.Result_RESULT_SUCCESS:
+			return 1
+		case runnerv1.Result_RESULT_CANCELLED:
+			return 2
+		default:
+			return 3
+		}
+	}
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+func asTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func duration(start, stop time.Time) float64 {
+	if start.IsZero() || stop.IsZero() {
+		return 0
+	}
+	return stop.Sub(start).Seconds()
+}
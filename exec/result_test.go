@@ -0,0 +1,48 @@
+package exec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestJobResult(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := jobRun{Name: "test (linux)", StepNames: []string{"checkout", "build"}}
+	state := &runnerv1.TaskState{
+		Result:    runnerv1.Result_RESULT_FAILURE,
+		StartedAt: timestamppb.New(start),
+		StoppedAt: timestamppb.New(start.Add(3 * time.Second)),
+		Steps: []*runnerv1.StepState{
+			{Id: 0, Result: runnerv1.Result_RESULT_SUCCESS, StartedAt: timestamppb.New(start), StoppedAt: timestamppb.New(start.Add(time.Second))},
+			{Id: 1, Result: runnerv1.Result_RESULT_FAILURE, StartedAt: timestamppb.New(start.Add(time.Second)), StoppedAt: timestamppb.New(start.Add(3 * time.Second))},
+		},
+	}
+	job := jobResult("test", run, state, map[string]string{"version": "1"}, nil)
+	assert.Equal(t, "failure", job.Result)
+	assert.Equal(t, "build", job.Steps[1].Name)
+	assert.Equal(t, "failure", job.Steps[1].Result)
+	assert.Equal(t, map[string]string{"version": "1"}, job.Outputs)
+
+	result := &Result{Result: job.Result, Jobs: []JobResult{job}}
+	assert.True(t, result.Failed())
+	assert.False(t, result.Cancelled())
+	out := &bytes.Buffer{}
+	assert.NoError(t, result.WriteJUnit(out))
+	assert.Contains(t, out.String(), `<testsuites tests="2" failures="1" skipped="0" time="3">`)
+	assert.Contains(t, out.String(), `<testcase name="build" classname="test (linux)" time="2">`)
+}
+
+func TestJobResultWithoutState(t *testing.T) {
+	job := jobResult("test", jobRun{Name: "test"}, nil, nil, errors.New("failed to execute worker"))
+	assert.Equal(t, "failure", job.Result)
+	result := &Result{Result: job.Result, Jobs: []JobResult{job}}
+	out := &bytes.Buffer{}
+	assert.NoError(t, result.WriteJUnit(out))
+	assert.Contains(t, out.String(), `<failure message="failed to execute worker"></failure>`)
+}
@@ -0,0 +1,155 @@
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/nektos/act/pkg/model"
+	"gopkg.in/yaml.v3"
+)
+
+// workflowJob is a job of the workflow with one run per matrix combination
+type workflowJob struct {
+	ID string
+	// Name is the name of the job without the matrix values
+	Name        string
+	Needs       []string
+	MaxParallel int
+	Runs        []jobRun
+}
+
+// jobRun is the single job payload of a matrix combination
+type jobRun struct {
+	Name      string
+	Payload   []byte
+	StepNames []string
+}
+
+// planWorkflow splits the workflow into single job payloads ordered by needs,
+// a non empty filter selects the jobs to run together with the jobs they need
+func planWorkflow(content []byte, filter []string) ([]*workflowJob, error) {
+	workflow, err := model.ReadWorkflow(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]any{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	jobIDs := workflow.GetJobIDs()
+	slices.Sort(jobIDs)
+	if len(jobIDs) == 0 {
+		return nil, fmt.Errorf("no jobs found")
+	}
+	if len(filter) > 0 {
+		for _, id := range filter {
+			if workflow.GetJob(id) == nil {
+				return nil, fmt.Errorf("job %s not found, available jobs: %v", id, jobIDs)
+			}
+		}
+		jobIDs = filter
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := map[string]int{}
+	jobs := []*workflowJob{}
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("job %s is part of a needs cycle", id)
+		case visited:
+			return nil
+		}
+		state[id] = visiting
+		job := workflow.GetJob(id)
+		for _, need := range job.Needs() {
+			if workflow.GetJob(need) == nil {
+				return fmt.Errorf("job %s needs unknown job %s", id, need)
+			}
+			if err := visit(need); err != nil {
+				return err
+			}
+		}
+		state[id] = visited
+
+		matrixes, err := job.GetMatrixes()
+		if err != nil {
+			return fmt.Errorf("job %s: %w", id, err)
+		}
+		planned := &workflowJob{ID: id, Name: job.Name, Needs: job.Needs(), MaxParallel: len(matrixes)}
+		if planned.Name == "" {
+			planned.Name = id
+		}
+		if job.Strategy != nil && job.Strategy.MaxParallel > 0 {
+			planned.MaxParallel = min(job.Strategy.MaxParallel, len(matrixes))
+		}
+		stepNames := []string{}
+		for _, step := range job.Steps {
+			stepNames = append(stepNames, step.String())
+		}
+		for _, matrix := range matrixes {
+			payload, err := jobPayload(raw, id, matrix)
+			if err != nil {
+				return fmt.Errorf("job %s: %w", id, err)
+			}
+			planned.Runs = append(planned.Runs, jobRun{Name: runName(job, id, matrix), Payload: payload, StepNames: stepNames})
+		}
+		jobs = append(jobs, planned)
+		return nil
+	}
+	for _, id := range jobIDs {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+// jobPayload returns the workflow with the single job id, the matrix is reduced to the given combination
+func jobPayload(raw map[string]any, id string, matrix map[string]any) ([]byte, error) {
+	workflow := maps.Clone(raw)
+	rawJobs, _ := raw["jobs"].(map[string]any)
+	job, _ := rawJobs[id].(map[string]any)
+	job = maps.Clone(job)
+	if job == nil {
+		job = map[string]any{}
+	}
+	if len(matrix) > 0 {
+		strategy, _ := job["strategy"].(map[string]any)
+		strategy = maps.Clone(strategy)
+		if strategy == nil {
+			strategy = map[string]any{}
+		}
+		combination := map[string]any{}
+		for k, v := range matrix {
+			combination[k] = []any{v}
+		}
+		strategy["matrix"] = combination
+		job["strategy"] = strategy
+	}
+	workflow["jobs"] = map[string]any{id: job}
+	return yaml.Marshal(workflow)
+}
+
+// runName appends the matrix values to the job name like gitea does
+func runName(job *model.Job, id string, matrix map[string]any) string {
+	name := job.Name
+	if name == "" {
+		name = id
+	}
+	if len(matrix) == 0 {
+		return name
+	}
+	values := []string{}
+	for _, k := range slices.Sorted(maps.Keys(matrix)) {
+		values = append(values, fmt.Sprint(matrix[k]))
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(values, ", "))
+}
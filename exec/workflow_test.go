@@ -0,0 +1,88 @@
+package exec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nektos/act/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const testWorkflow = `
+on: push
+jobs:
+  test:
+    needs: build
+    runs-on: self-hosted
+    strategy:
+      max-parallel: 1
+      matrix:
+        os: [linux, windows]
+        go: ["1.24"]
+    steps:
+    - run: echo ${{ matrix.os }}
+  build:
+    runs-on: self-hosted
+    outputs:
+      version: ${{ steps.version.outputs.version }}
+    steps:
+    - id: version
+      run: echo version=1 >> $GITHUB_OUTPUT
+  lint:
+    runs-on: self-hosted
+    steps:
+    - run: echo lint
+`
+
+func TestPlanWorkflow(t *testing.T) {
+	jobs, err := planWorkflow([]byte(testWorkflow), nil)
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	assert.Equal(t, []string{"build", "lint", "test"}, ids)
+
+	test := jobs[2]
+	assert.Equal(t, []string{"build"}, test.Needs)
+	assert.Equal(t, 1, test.MaxParallel)
+	assert.Len(t, test.Runs, 2)
+	names := []string{test.Runs[0].Name, test.Runs[1].Name}
+	assert.ElementsMatch(t, []string{"test (1.24, linux)", "test (1.24, windows)"}, names)
+
+	workflow, err := model.ReadWorkflow(bytes.NewReader(test.Runs[0].Payload))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test"}, workflow.GetJobIDs())
+	matrixes, err := workflow.GetJob("test").GetMatrixes()
+	assert.NoError(t, err)
+	assert.Len(t, matrixes, 1)
+}
+
+func TestPlanWorkflowFilter(t *testing.T) {
+	jobs, err := planWorkflow([]byte(testWorkflow), []string{"test"})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "build", jobs[0].ID)
+	assert.Equal(t, "test", jobs[1].ID)
+
+	_, err = planWorkflow([]byte(testWorkflow), []string{"deploy"})
+	assert.Error(t, err)
+}
+
+func TestPlanWorkflowCycle(t *testing.T) {
+	_, err := planWorkflow([]byte(`
+on: push
+jobs:
+  a:
+    needs: b
+    runs-on: self-hosted
+    steps:
+    - run: echo a
+  b:
+    needs: a
+    runs-on: self-hosted
+    steps:
+    - run: echo b
+`), nil)
+	assert.ErrorContains(t, err, "cycle")
+}
@@ -0,0 +1,215 @@
+package gc
+
+import (
+	"cmp"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cloneGrace protects clone directories which have been created, but not yet recorded in the journal
+const cloneGrace = 10 * time.Minute
+
+// Options selects what is removed below the working directory of the runner
+type Options struct {
+	// Dir contains the actions-runner-<version>, runners and cache directories
+	Dir string
+	// Workers are the worker args of all registrations, runner versions outside of them are removed.
+	// Runner versions are kept if no registration has worker args
+	Workers [][]string
+	// Owned are the clone directories of running tasks
+	Owned []string
+	// CacheMaxAge removes cache entries written before this duration, 0 keeps them
+	CacheMaxAge time.Duration
+	// CacheMaxSize removes the oldest cache entries above this amount of bytes, 0 is unlimited
+	CacheMaxSize int64
+	// DryRun only lists what would be removed
+	DryRun bool
+}
+
+// Item is a file or directory removed by Run
+type Item struct {
+	Path   string
+	Size   int64
+	Reason string
+}
+
+// Run removes stale runner versions, clone directories and cache entries and returns them
+func Run(opts Options) ([]Item, error) {
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	workers := slices.Clone(opts.Workers)
+	for _, clone := range opts.Owned {
+		// clones of running tasks link to the runner version they have been created from
+		if root, err := filepath.EvalSymlinks(filepath.Join(clone, "externals")); err == nil && len(workers) > 0 {
+			workers = append(workers, []string{filepath.Dir(root)})
+		}
+	}
+	runners, err := staleRunners(dir, workers)
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, runners...)
+	clones, err := staleClones(dir, opts.Owned)
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, clones...)
+	caches, err := staleCaches(dir, opts.CacheMaxAge, opts.CacheMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, caches...)
+	if opts.DryRun {
+		return items, nil
+	}
+	removed := items[:0]
+	for _, item := range items {
+		if err := os.RemoveAll(item.Path); err != nil {
+			log.WithError(err).Warnf("gc: cannot remove %s", item.Path)
+			continue
+		}
+		removed = append(removed, item)
+	}
+	return removed, nil
+}
+
+// staleRunners returns the actions-runner-<version> directories which are not part of any worker args
+func staleRunners(dir string, workers [][]string) ([]Item, error) {
+	if len(workers) == 0 {
+		return nil, nil
+	}
+	var paths []string
+	for _, worker := range workers {
+		for _, arg := range worker {
+			if strings.HasPrefix(arg, "--") {
+				_, arg, _ = strings.Cut(arg, "=")
+			}
+			if arg == "" {
+				continue
+			}
+			if !filepath.IsAbs(arg) {
+				arg = filepath.Join(dir, arg)
+			}
+			paths = append(paths, filepath.Clean(arg))
+		}
+	}
+	entries, err := filepath.Glob(filepath.Join(dir, "actions-runner-*"))
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, entry := range entries {
+		if st, err := os.Stat(entry); err != nil || !st.IsDir() {
+			continue
+		}
+		referenced := slices.ContainsFunc(paths, func(p string) bool {
+			return p == entry || strings.HasPrefix(p, entry+string(filepath.Separator))
+		})
+		if !referenced {
+			items = append(items, Item{Path: entry, Size: dirSize(entry), Reason: "runner version not used by any registration"})
+		}
+	}
+	return items, nil
+}
+
+// staleClones returns the runners/runner-* directories which are not owned by a running task
+func staleClones(dir string, owned []string) ([]Item, error) {
+	entries, err := filepath.Glob(filepath.Join(dir, "runners", "runner-*"))
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, entry := range entries {
+		st, err := os.Stat(entry)
+		if err != nil || !st.IsDir() || time.Since(st.ModTime()) < cloneGrace {
+			continue
+		}
+		if slices.ContainsFunc(owned, func(p string) bool {
+			abs, err := filepath.Abs(p)
+			return err == nil && abs == entry
+		}) {
+			continue
+		}
+		items = append(items, Item{Path: entry, Size: dirSize(entry), Reason: "clone directory without running task"})
+	}
+	return items, nil
+}
+
+// staleCaches returns the files of the builtin cache which are older than maxAge or exceed maxSize,
+// the cache server forgets entries whose file has been removed
+func staleCaches(dir string, maxAge time.Duration, maxSize int64) ([]Item, error) {
+	if maxAge <= 0 && maxSize <= 0 {
+		return nil, nil
+	}
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	err := filepath.WalkDir(filepath.Join(dir, "cache", "cache"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{path: p, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// newest first, the oldest entries exceed the size limit
+	slices.SortFunc(files, func(a, b file) int {
+		return b.modTime.Compare(a.modTime)
+	})
+	var items []Item
+	var total int64
+	exceeded := false
+	for _, f := range files {
+		switch {
+		case maxAge > 0 && time.Since(f.modTime) > maxAge:
+			items = append(items, Item{Path: f.path, Size: f.size, Reason: "cache entry older than " + maxAge.String()})
+		case exceeded || maxSize > 0 && total+f.size > maxSize:
+			exceeded = true
+			items = append(items, Item{Path: f.path, Size: f.size, Reason: "cache exceeds its size limit"})
+		default:
+			total += f.size
+		}
+	}
+	slices.SortStableFunc(items, func(a, b Item) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return items, nil
+}
+
+// dirSize returns the size of the regular files below dir, symlinks are not followed
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
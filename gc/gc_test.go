@@ -0,0 +1,76 @@
+package gc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	mkdir := func(p string, age time.Duration) string {
+		p = filepath.Join(dir, p)
+		assert.NoError(t, os.MkdirAll(p, 0o755))
+		assert.NoError(t, os.Chtimes(p, time.Now().Add(-age), time.Now().Add(-age)))
+		return p
+	}
+	write := func(p string, size int, age time.Duration) string {
+		p = filepath.Join(dir, p)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(t, os.WriteFile(p, make([]byte, size), 0o644))
+		assert.NoError(t, os.Chtimes(p, time.Now().Add(-age), time.Now().Add(-age)))
+		return p
+	}
+	current := mkdir("actions-runner-2.329.0", 0)
+	old := mkdir("actions-runner-2.328.0", 0)
+	linked := mkdir("actions-runner-2.327.0", 0)
+	mkdir("actions-runner-2.327.0/externals", 0)
+	owned := mkdir("runners/runner-owned", time.Hour)
+	assert.NoError(t, os.Symlink(filepath.Join(linked, "externals"), filepath.Join(owned, "externals")))
+	assert.NoError(t, os.Chtimes(owned, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	stale := mkdir("runners/runner-stale", time.Hour)
+	fresh := mkdir("runners/runner-fresh", 0)
+	expired := write("cache/cache/01/1", 10, 10*24*time.Hour)
+	large := write("cache/cache/02/2", 20, 2*time.Hour)
+	recent := write("cache/cache/03/3", 20, time.Hour)
+	db := write("cache/bolt.db", 10, 10*24*time.Hour)
+
+	opts := Options{
+		Dir:          dir,
+		Workers:      [][]string{{"--runner-dir=" + current, "python3", filepath.Join(current, "actions-runner-worker.py")}},
+		Owned:        []string{owned},
+		CacheMaxAge:  7 * 24 * time.Hour,
+		CacheMaxSize: 30,
+		DryRun:       true,
+	}
+	items, err := Run(opts)
+	assert.NoError(t, err)
+	paths := []string{}
+	for _, item := range items {
+		paths = append(paths, item.Path)
+	}
+	assert.ElementsMatch(t, []string{old, stale, expired, large}, paths)
+	_, err = os.Stat(old)
+	assert.NoError(t, err, "dry run removed %s", old)
+
+	opts.DryRun = false
+	_, err = Run(opts)
+	assert.NoError(t, err)
+	for _, p := range []string{old, stale, expired, large} {
+		_, err := os.Stat(p)
+		assert.True(t, os.IsNotExist(err), p)
+	}
+	for _, p := range []string{current, linked, owned, fresh, recent, db} {
+		_, err := os.Stat(p)
+		assert.NoError(t, err, p)
+	}
+
+	// without known worker args all runner versions are kept
+	opts.Workers = nil
+	items, err = Run(opts)
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
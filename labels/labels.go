@@ -0,0 +1,119 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+	// imageRegexp is a simplified docker image reference [registry[:port]/]path[:tag][@digest]
+	imageRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9.-]+(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*(?::[\w][\w.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+)
+
+const (
+	SchemeHost   = "host"
+	SchemeDocker = "docker"
+)
+
+// Label is a runner label with the syntax name[:scheme[:arg]], for example ubuntu-latest:docker://node:20
+type Label struct {
+	Name   string
+	Scheme string
+	Arg    string
+}
+
+// Parse splits a label, a label without scheme runs on the host
+func Parse(str string) (*Label, error) {
+	name, rest, _ := strings.Cut(str, ":")
+	label := &Label{
+		Name:   name,
+		Scheme: SchemeHost,
+	}
+	if rest != "" {
+		label.Scheme, label.Arg, _ = strings.Cut(rest, ":")
+	}
+	if !nameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("label %q: invalid name, use letters, digits, '.', '_' and '-'", str)
+	}
+	switch label.Scheme {
+	case SchemeHost:
+		if label.Arg != "" {
+			return nil, fmt.Errorf("label %q: the host scheme has no argument", str)
+		}
+	case SchemeDocker:
+		if !strings.HasPrefix(label.Arg, "//") || len(label.Arg) == len("//") {
+			return nil, fmt.Errorf("label %q: expected docker://image", str)
+		}
+		if image := label.Image(); !imageRegexp.MatchString(image) {
+			return nil, fmt.Errorf("label %q: invalid image reference %q", str, image)
+		}
+	default:
+		return nil, fmt.Errorf("label %q: unsupported scheme %q, expected %s or %s", str, label.Scheme, SchemeHost, SchemeDocker)
+	}
+	return label, nil
+}
+
+// Image returns the container image of docker labels
+func (l *Label) Image() string {
+	if l.Scheme != SchemeDocker {
+		return ""
+	}
+	return strings.TrimPrefix(l.Arg, "//")
+}
+
+// Validate reports invalid and duplicated labels
+func Validate(strs []string) error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, str := range strs {
+		label, err := Parse(str)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen[label.Name] {
+			errs = append(errs, fmt.Errorf("label %q: duplicated name %q", str, label.Name))
+		}
+		seen[label.Name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// Labels are the parsed labels of a runner
+type Labels []*Label
+
+// ParseAll parses all labels and skips invalid ones
+func ParseAll(strs []string) Labels {
+	ls := make(Labels, 0, len(strs))
+	for _, str := range strs {
+		if label, err := Parse(str); err == nil {
+			ls = append(ls, label)
+		}
+	}
+	return ls
+}
+
+// PickImage returns the image of the first runs-on label known to the runner, later labels are ignored.
+// An empty string runs the job on the host, if that label has the host scheme or no label is known
+func (ls Labels) PickImage(runsOn []string) string {
+	for _, name := range runsOn {
+		for _, label := range ls {
+			if label.Name == name {
+				return label.Image()
+			}
+		}
+	}
+	return ""
+}
+
+// Names strips the schemes of the labels, the server only knows the names
+func Names(strs []string) []string {
+	names := make([]string, len(strs))
+	for i, str := range strs {
+		names[i], _, _ = strings.Cut(str, ":")
+	}
+	return names
+}
@@ -0,0 +1,42 @@
+package labels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	label, err := Parse("ubuntu-latest:docker://node:20")
+	assert.NoError(t, err)
+	assert.Equal(t, &Label{Name: "ubuntu-latest", Scheme: SchemeDocker, Arg: "//node:20"}, label)
+	assert.Equal(t, "node:20", label.Image())
+
+	label, err = Parse("self-hosted")
+	assert.NoError(t, err)
+	assert.Equal(t, SchemeHost, label.Scheme)
+	assert.Equal(t, "", label.Image())
+
+	_, err = Parse("ubuntu-latest:dokcer://node")
+	assert.Error(t, err)
+	_, err = Parse("ubuntu-latest:docker://")
+	assert.Error(t, err)
+}
+
+func TestPickImage(t *testing.T) {
+	ls := ParseAll([]string{"self-hosted:host", "ubuntu-latest:docker://node:20"})
+	assert.Equal(t, "node:20", ls.PickImage([]string{"ubuntu-latest"}))
+	// the first known label decides
+	assert.Equal(t, "", ls.PickImage([]string{"self-hosted", "ubuntu-latest"}))
+	assert.Equal(t, "node:20", ls.PickImage([]string{"ubuntu-latest", "self-hosted"}))
+	assert.Equal(t, "node:20", ls.PickImage([]string{"windows", "ubuntu-latest", "self-hosted"}))
+	assert.Equal(t, "", ls.PickImage([]string{"windows"}))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate([]string{"self-hosted", "ubuntu-latest:docker://ghcr.io/catthehacker/ubuntu:act-22.04", "node:docker://localhost:5000/node@sha256:" + strings.Repeat("a", 64)}))
+	assert.ErrorContains(t, Validate([]string{"self-hosted", "self-hosted:host"}), "duplicated")
+	assert.ErrorContains(t, Validate([]string{"ubuntu-latest:docker://Node"}), "invalid image")
+	assert.ErrorContains(t, Validate([]string{"ubuntu latest"}), "invalid name")
+}
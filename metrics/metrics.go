@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"github.com/ChristopherHX/gitea-actions-runner/poller"
+	"github.com/ChristopherHX/gitea-actions-runner/runtime"
+
+	"connectrpc.com/connect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gitea_runner"
+
+var (
+	_ poller.Metric  = (*Prometheus)(nil)
+	_ runtime.Metric = (*Prometheus)(nil)
+)
+
+// Prometheus drives the scheduling of the poller and exports the state of the runner
+type Prometheus struct {
+	busyWorkers int64
+	capacity    int64
+	registry    *prometheus.Registry
+
+	fetchTaskDuration prometheus.Histogram
+	fetchTaskErrors   *prometheus.CounterVec
+	tasksStarted      prometheus.Counter
+	tasksFinished     *prometheus.CounterVec
+	jobDuration       *prometheus.HistogramVec
+	updateLogErrors   prometheus.Counter
+	updateTaskErrors  prometheus.Counter
+	bufferedLogRows   prometheus.Gauge
+}
+
+// New creates the collectors of the runner
+func New(capacity int) *Prometheus {
+	m := &Prometheus{
+		capacity: int64(capacity),
+		registry: prometheus.NewRegistry(),
+		fetchTaskDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "fetch_task_duration_seconds",
+			Help:      "Latency of FetchTask calls.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		fetchTaskErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fetch_task_errors_total",
+			Help:      "Failed FetchTask calls by connect error code.",
+		}, []string{"code"}),
+		tasksStarted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tasks_started_total",
+			Help:      "Tasks fetched and dispatched to a worker.",
+		}),
+		tasksFinished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tasks_finished_total",
+			Help:      "Finished tasks by result.",
+		}, []string{"result"}),
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_duration_seconds",
+			Help:      "Duration of finished jobs by result.",
+			Buckets:   []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400, 21600},
+		}, []string{"result"}),
+		updateLogErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "update_log_errors_total",
+			Help:      "Failed UpdateLog calls.",
+		}),
+		updateTaskErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "update_task_errors_total",
+			Help:      "Failed UpdateTask calls.",
+		}),
+		bufferedLogRows: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "log_rows_buffered",
+			Help:      "Log rows not yet acknowledged by the server.",
+		}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "busy_slots",
+			Help:      "Slots running a task.",
+		}, func() float64 {
+			return float64(m.BusyWorkers())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "idle_slots",
+			Help:      "Slots waiting for a task.",
+		}, func() float64 {
+			idle := atomic.LoadInt64(&m.capacity) - m.BusyWorkers()
+			if idle < 0 {
+				idle = 0
+			}
+			return float64(idle)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "capacity",
+			Help:      "Configured capacity of the runner.",
+		}, func() float64 {
+			return float64(atomic.LoadInt64(&m.capacity))
+		}),
+		m.fetchTaskDuration,
+		m.fetchTaskErrors,
+		m.tasksStarted,
+		m.tasksFinished,
+		m.jobDuration,
+		m.updateLogErrors,
+		m.updateTaskErrors,
+		m.bufferedLogRows,
+	)
+	return m
+}
+
+// Handler serves the metrics in the prometheus text format
+func (m *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// SetCapacity updates the exported capacity
+func (m *Prometheus) SetCapacity(capacity int) {
+	atomic.StoreInt64(&m.capacity, int64(capacity))
+}
+
+// Capacity returns the shared capacity
+func (m *Prometheus) Capacity() int {
+	return int(atomic.LoadInt64(&m.capacity))
+}
+
+func (m *Prometheus) IncBusyWorker() int64 {
+	return atomic.AddInt64(&m.busyWorkers, 1)
+}
+
+func (m *Prometheus) DecBusyWorker() int64 {
+	return atomic.AddInt64(&m.busyWorkers, -1)
+}
+
+func (m *Prometheus) BusyWorkers() int64 {
+	return atomic.LoadInt64(&m.busyWorkers)
+}
+
+func (m *Prometheus) ObserveFetchTask(duration time.Duration, err error) {
+	m.fetchTaskDuration.Observe(duration.Seconds())
+	if err != nil {
+		m.fetchTaskErrors.WithLabelValues(connect.CodeOf(err).String()).Inc()
+	}
+}
+
+func (m *Prometheus) TaskStarted() {
+	m.tasksStarted.Inc()
+}
+
+func (m *Prometheus) TaskFinished(result runnerv1.Result, duration time.Duration) {
+	label := resultLabel(result)
+	m.tasksFinished.WithLabelValues(label).Inc()
+	if result != runnerv1.Result_RESULT_SKIPPED {
+		m.jobDuration.WithLabelValues(label).Observe(duration.Seconds())
+	}
+}
+
+func (m *Prometheus) UpdateLogFailed() {
+	m.updateLogErrors.Inc()
+}
+
+func (m *Prometheus) UpdateTaskFailed() {
+	m.updateTaskErrors.Inc()
+}
+
+func (m *Prometheus) AddBufferedLogRows(delta int64) {
+	m.bufferedLogRows.Add(float64(delta))
+}
+
+// resultLabel converts RESULT_SUCCESS to success
+func resultLabel(result runnerv1.Result) string {
+	return strings.ToLower(strings.TrimPrefix(result.String(), "RESULT_"))
+}
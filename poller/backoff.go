@@ -0,0 +1,66 @@
+package poller
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes the delay between failed FetchTask calls.
+// The delay starts at Min, doubles after every failure up to Max and
+// is randomized by Jitter (a fraction of the delay) so that a fleet of
+// runners does not reconnect to the server at the same moment.
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Jitter float64
+
+	attempts int
+}
+
+// NewBackoff returns a backoff policy, invalid values are replaced by sane defaults
+func NewBackoff(min, max time.Duration, jitter float64) *Backoff {
+	if min <= 0 {
+		min = 5 * time.Second
+	}
+	if max < min {
+		max = min
+	}
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	return &Backoff{
+		Min:    min,
+		Max:    max,
+		Jitter: jitter,
+	}
+}
+
+// Next returns the delay before the next attempt and records a failure
+func (b *Backoff) Next() time.Duration {
+	delay := b.Min
+	for i := 0; i < b.attempts && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+	b.attempts++
+	if b.Jitter > 0 {
+		// spread the delay over [delay - jitter, delay + jitter]
+		spread := float64(delay) * b.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+	return delay
+}
+
+// Attempts returns the number of failures since the last Reset
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
+
+// Reset is called after a successful attempt
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
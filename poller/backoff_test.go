@@ -0,0 +1,65 @@
+package poller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff(time.Second, 10*time.Second, 0)
+	assert.Equal(t, time.Second, b.Next())
+	assert.Equal(t, 2*time.Second, b.Next())
+	assert.Equal(t, 4*time.Second, b.Next())
+	assert.Equal(t, 8*time.Second, b.Next())
+	assert.Equal(t, 10*time.Second, b.Next())
+	assert.Equal(t, 10*time.Second, b.Next())
+	assert.Equal(t, 6, b.Attempts())
+	b.Reset()
+	assert.Equal(t, 0, b.Attempts())
+	assert.Equal(t, time.Second, b.Next())
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := NewBackoff(10*time.Second, time.Minute, 0.5)
+	for i := 0; i < 100; i++ {
+		b.Reset()
+		delay := b.Next()
+		assert.GreaterOrEqual(t, delay, 5*time.Second)
+		assert.LessOrEqual(t, delay, 15*time.Second)
+	}
+}
+
+func TestPollBackoffCodes(t *testing.T) {
+	for _, tc := range []struct {
+		code     connect.Code
+		attempts int
+	}{
+		{code: connect.CodeUnavailable, attempts: 1},
+		{code: connect.CodeDeadlineExceeded, attempts: 1},
+		{code: connect.CodeInvalidArgument, attempts: 0},
+		{code: connect.CodeInternal, attempts: 0},
+	} {
+		t.Run(tc.code.String(), func(t *testing.T) {
+			cli := &fakeClient{code: tc.code}
+			p := New(cli, func(ctx context.Context, task *runnerv1.Task) error { return nil }, 1, nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- p.Poll(ctx)
+			}()
+			assert.Eventually(t, func() bool { return cli.fetched.Load() > 0 }, 5*time.Second, time.Millisecond)
+			// the poller waits for the retry after the first failure
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			assert.NoError(t, <-done)
+			assert.EqualValues(t, 1, cli.fetched.Load())
+			assert.Equal(t, tc.attempts, p.Backoff.Attempts())
+		})
+	}
+}
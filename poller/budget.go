@@ -0,0 +1,59 @@
+package poller
+
+import "sync"
+
+// Budget limits the amount of running tasks of several pollers,
+// a slot is reserved for every FetchTask call and kept while the task is running
+type Budget struct {
+	mu       sync.Mutex
+	capacity int
+	used     int
+	released chan struct{}
+}
+
+// NewBudget creates a budget shared by pollers
+func NewBudget(capacity int) *Budget {
+	return &Budget{
+		capacity: capacity,
+		released: make(chan struct{}),
+	}
+}
+
+// TryAcquire reserves a slot if one is free
+func (b *Budget) TryAcquire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used >= b.capacity {
+		return false
+	}
+	b.used++
+	return true
+}
+
+// Release frees a slot and wakes up all waiting pollers
+func (b *Budget) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used--
+	b.notify()
+}
+
+// Released is closed as soon as a slot may be available again
+func (b *Budget) Released() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.released
+}
+
+// SetCapacity changes the amount of slots, running tasks are not affected
+func (b *Budget) SetCapacity(capacity int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.capacity = capacity
+	b.notify()
+}
+
+func (b *Budget) notify() {
+	close(b.released)
+	b.released = make(chan struct{})
+}
@@ -0,0 +1,73 @@
+package poller
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetConcurrent(t *testing.T) {
+	b := NewBudget(3)
+	var running, maxRunning atomic.Int64
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				for {
+					released := b.Released()
+					if b.TryAcquire() {
+						break
+					}
+					<-released
+				}
+				n := running.Add(1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				running.Add(-1)
+				b.Release()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, maxRunning.Load(), int64(3))
+	// all slots have been released
+	for range 3 {
+		assert.True(t, b.TryAcquire())
+	}
+	assert.False(t, b.TryAcquire())
+}
+
+func TestBudgetShrink(t *testing.T) {
+	b := NewBudget(3)
+	for range 3 {
+		assert.True(t, b.TryAcquire())
+	}
+	released := b.Released()
+	b.SetCapacity(1)
+	select {
+	case <-released:
+	default:
+		t.Fatal("waiting pollers are not woken up by SetCapacity")
+	}
+	// running tasks keep their slots
+	assert.False(t, b.TryAcquire())
+	b.Release()
+	assert.False(t, b.TryAcquire())
+	b.Release()
+	assert.False(t, b.TryAcquire())
+	b.Release()
+	assert.True(t, b.TryAcquire())
+	assert.False(t, b.TryAcquire())
+
+	b.SetCapacity(2)
+	assert.True(t, b.TryAcquire())
+	assert.False(t, b.TryAcquire())
+}
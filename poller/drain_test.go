@@ -0,0 +1,112 @@
+//go:build !windows
+
+package poller
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// drainTest runs two tasks which block until release is closed or their context is cancelled
+type drainTest struct {
+	client    *fakeClient
+	poller    *Poller
+	started   chan struct{}
+	release   chan struct{}
+	finished  atomic.Int64
+	cancelled atomic.Int64
+	done      chan error
+}
+
+func newDrainTest(t *testing.T) *drainTest {
+	// keep signals sent by the test from terminating the process before Poll traps them
+	trap := make(chan os.Signal, 1)
+	signal.Notify(trap, syscall.SIGUSR1, syscall.SIGTERM)
+	t.Cleanup(func() { signal.Stop(trap) })
+
+	d := &drainTest{
+		client:  &fakeClient{tasks: true},
+		started: make(chan struct{}, 2),
+		release: make(chan struct{}),
+		done:    make(chan error, 1),
+	}
+	d.poller = New(d.client, func(ctx context.Context, task *runnerv1.Task) error {
+		d.started <- struct{}{}
+		select {
+		case <-d.release:
+			d.finished.Add(1)
+		case <-ctx.Done():
+			d.cancelled.Add(1)
+		}
+		return nil
+	}, 2, nil)
+	return d
+}
+
+// start polls until both tasks are running
+func (d *drainTest) start(t *testing.T) {
+	go func() {
+		d.done <- d.poller.Poll(context.Background())
+	}()
+	for range 2 {
+		select {
+		case <-d.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("tasks have not been started")
+		}
+	}
+}
+
+func (d *drainTest) wait(t *testing.T) {
+	select {
+	case err := <-d.done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("poller did not stop")
+	}
+}
+
+func TestDrainSignal(t *testing.T) {
+	d := newDrainTest(t)
+	d.start(t)
+	assert.NoError(t, syscall.Kill(os.Getpid(), drainSignals[0].(syscall.Signal)))
+	time.Sleep(100 * time.Millisecond)
+	close(d.release)
+	d.wait(t)
+	assert.EqualValues(t, 2, d.finished.Load())
+	assert.EqualValues(t, 0, d.cancelled.Load())
+	// no task is fetched after the drain
+	assert.EqualValues(t, 2, d.client.fetched.Load())
+}
+
+func TestDrainTimeout(t *testing.T) {
+	d := newDrainTest(t)
+	d.poller.DrainTimeout = 50 * time.Millisecond
+	d.start(t)
+	d.poller.Drain()
+	d.wait(t)
+	assert.EqualValues(t, 0, d.finished.Load())
+	assert.EqualValues(t, 2, d.cancelled.Load())
+	assert.EqualValues(t, 2, d.client.fetched.Load())
+}
+
+func TestDrainHardCancel(t *testing.T) {
+	d := newDrainTest(t)
+	d.start(t)
+	d.poller.Drain()
+	time.Sleep(100 * time.Millisecond)
+	// SIGTERM cancels the tasks still running during the drain
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	d.wait(t)
+	assert.EqualValues(t, 0, d.finished.Load())
+	assert.EqualValues(t, 2, d.cancelled.Load())
+}
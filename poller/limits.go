@@ -0,0 +1,102 @@
+package poller
+
+import (
+	"sync"
+	"time"
+)
+
+// Limits counts the tasks of all pollers of a daemon for MaxJobs and IdleTimeout,
+// a job is reserved for every FetchTask call so the pollers never start more than MaxJobs tasks
+type Limits struct {
+	// MaxJobs stops polling after this amount of tasks, 0 is unlimited
+	MaxJobs int
+	// IdleTimeout stops polling if no task has been running for this duration, 0 is unlimited
+	IdleTimeout time.Duration
+
+	mu           sync.Mutex
+	started      int
+	reserved     int
+	running      int
+	lastActivity time.Time
+	changed      chan struct{}
+}
+
+// NewLimits creates limits shared by pollers
+func NewLimits(maxJobs int, idleTimeout time.Duration) *Limits {
+	return &Limits{
+		MaxJobs:      maxJobs,
+		IdleTimeout:  idleTimeout,
+		lastActivity: time.Now(),
+		changed:      make(chan struct{}),
+	}
+}
+
+// Reserve reserves a job before FetchTask, it returns ErrMaxJobsReached once MaxJobs tasks have been started
+// and false while the remaining jobs are reserved by other pollers
+func (l *Limits) Reserve() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.MaxJobs <= 0 {
+		return true, nil
+	}
+	if l.started >= l.MaxJobs {
+		return false, ErrMaxJobsReached
+	}
+	if l.started+l.reserved >= l.MaxJobs {
+		return false, nil
+	}
+	l.reserved++
+	return true, nil
+}
+
+// Unreserve returns the reservation of a FetchTask call without task
+func (l *Limits) Unreserve() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.MaxJobs > 0 {
+		l.reserved--
+	}
+	l.notify()
+}
+
+// Started turns the reservation into a running task and reports whether it is the last job
+func (l *Limits) Started() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.MaxJobs > 0 {
+		l.reserved--
+	}
+	l.started++
+	l.running++
+	l.lastActivity = time.Now()
+	l.notify()
+	return l.MaxJobs > 0 && l.started >= l.MaxJobs
+}
+
+// Finished records the end of a running task
+func (l *Limits) Finished() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.lastActivity = time.Now()
+	l.notify()
+}
+
+// Idle reports whether no task of any poller has been running for IdleTimeout
+func (l *Limits) Idle() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.IdleTimeout > 0 && l.running == 0 && time.Since(l.lastActivity) >= l.IdleTimeout
+}
+
+// Changed is closed as soon as a reservation is returned or a task started or finished
+func (l *Limits) Changed() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.changed
+}
+
+func (l *Limits) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
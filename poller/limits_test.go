@@ -0,0 +1,125 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"github.com/ChristopherHX/gitea-actions-runner/client"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient returns a new task for every FetchTask call if tasks is set, or fails with code if it is set
+type fakeClient struct {
+	client.Client
+	tasks   bool
+	code    connect.Code
+	fetched atomic.Int64
+}
+
+func (c *fakeClient) FetchTask(ctx context.Context, req *connect.Request[runnerv1.FetchTaskRequest]) (*connect.Response[runnerv1.FetchTaskResponse], error) {
+	n := c.fetched.Add(1)
+	if c.code != 0 {
+		return nil, connect.NewError(c.code, errors.New("fetch failed"))
+	}
+	if !c.tasks {
+		return connect.NewResponse(&runnerv1.FetchTaskResponse{}), nil
+	}
+	return connect.NewResponse(&runnerv1.FetchTaskResponse{Task: &runnerv1.Task{Id: n}}), nil
+}
+
+// pollAll runs the pollers until all of them returned
+func pollAll(t *testing.T, pollers ...*Poller) []error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errs := make([]error, len(pollers))
+	var wg sync.WaitGroup
+	for i, p := range pollers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = p.Poll(ctx)
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, ctx.Err(), "pollers did not stop")
+	return errs
+}
+
+func TestLimitsMaxJobs(t *testing.T) {
+	limits := NewLimits(3, 0)
+	var dispatched atomic.Int64
+	dispatch := func(ctx context.Context, task *runnerv1.Task) error {
+		dispatched.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+	var pollers []*Poller
+	for range 2 {
+		p := New(&fakeClient{tasks: true}, dispatch, 2, nil)
+		p.Limits = limits
+		pollers = append(pollers, p)
+	}
+	errs := pollAll(t, pollers...)
+	assert.Equal(t, []error{ErrMaxJobsReached, ErrMaxJobsReached}, errs)
+	assert.EqualValues(t, 3, dispatched.Load())
+}
+
+func TestLimitsIdleTimeout(t *testing.T) {
+	limits := NewLimits(0, time.Nanosecond)
+	dispatch := func(ctx context.Context, task *runnerv1.Task) error {
+		return nil
+	}
+	var pollers []*Poller
+	for range 2 {
+		p := New(&fakeClient{}, dispatch, 1, nil)
+		p.Limits = limits
+		pollers = append(pollers, p)
+	}
+	errs := pollAll(t, pollers...)
+	assert.Equal(t, []error{ErrIdleTimeout, ErrIdleTimeout}, errs)
+}
+
+func TestLimitsIdle(t *testing.T) {
+	limits := NewLimits(0, time.Nanosecond)
+	ok, err := limits.Reserve()
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	limits.Started()
+	time.Sleep(time.Millisecond)
+	// a task of any poller is running
+	assert.False(t, limits.Idle())
+	limits.Finished()
+	time.Sleep(time.Millisecond)
+	assert.True(t, limits.Idle())
+}
+
+func TestLimitsReserve(t *testing.T) {
+	limits := NewLimits(2, 0)
+	for range 2 {
+		ok, err := limits.Reserve()
+		assert.True(t, ok)
+		assert.NoError(t, err)
+	}
+	// the remaining jobs are reserved
+	ok, err := limits.Reserve()
+	assert.False(t, ok)
+	assert.NoError(t, err)
+
+	changed := limits.Changed()
+	limits.Unreserve()
+	<-changed
+	ok, _ = limits.Reserve()
+	assert.True(t, ok)
+
+	assert.False(t, limits.Started())
+	assert.True(t, limits.Started())
+	_, err = limits.Reserve()
+	assert.ErrorIs(t, err, ErrMaxJobsReached)
+}
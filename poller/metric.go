@@ -1,12 +1,19 @@
 package poller
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 // Metric interface
 type Metric interface {
 	IncBusyWorker() int64
 	DecBusyWorker() int64
 	BusyWorkers() int64
+	// ObserveFetchTask records the latency and the error of a FetchTask call
+	ObserveFetchTask(duration time.Duration, err error)
+	// TaskStarted is called before a fetched task is dispatched
+	TaskStarted()
 }
 
 var _ Metric = (*metric)(nil)
@@ -31,3 +38,7 @@ func (m *metric) DecBusyWorker() int64 {
 func (m *metric) BusyWorkers() int64 {
 	return atomic.LoadInt64(&m.busyWorkers)
 }
+
+func (m *metric) ObserveFetchTask(time.Duration, error) {}
+
+func (m *metric) TaskStarted() {}
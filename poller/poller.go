@@ -3,8 +3,10 @@ package poller
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -19,28 +21,65 @@ import (
 
 var ErrDataLock = errors.New("Data Lock Error")
 
-func New(cli client.Client, dispatch func(context.Context, *runnerv1.Task) error, workerNum int) *Poller {
+var (
+	// ErrMaxJobsReached is returned by Poll after MaxJobs tasks have been completed
+	ErrMaxJobsReached = errors.New("maximum number of jobs reached")
+	// ErrIdleTimeout is returned by Poll after no task has been fetched for IdleTimeout
+	ErrIdleTimeout = errors.New("idle timeout reached")
+	// ErrUnauthenticated is returned by Poll if the server keeps rejecting the runner token
+	ErrUnauthenticated = errors.New("runner is not authenticated")
+)
+
+// New creates a poller, the metric is shared with the caller to export the busy workers
+// a nil metric falls back to an in memory counter
+func New(cli client.Client, dispatch func(context.Context, *runnerv1.Task) error, workerNum int, m Metric) *Poller {
+	if m == nil {
+		m = NewMetric()
+	}
 	return &Poller{
 		Client:       cli,
 		Dispatch:     dispatch,
 		routineGroup: newRoutineGroup(),
-		metric:       &metric{},
+		metric:       m,
 		workerNum:    workerNum,
 		ready:        make(chan struct{}, 1),
+		Backoff:      NewBackoff(fetchInterval, 5*time.Minute, 0.2),
+		drain:        make(chan struct{}),
 	}
 }
 
+// fetchInterval is the delay between two FetchTask calls without an available task
+const fetchInterval = 5 * time.Second
+
+// maxUnauthenticated is the amount of consecutive Unauthenticated responses tolerated,
+// a restarting server may reject valid tokens for a short time
+const maxUnauthenticated = 3
+
 type Poller struct {
 	Client   client.Client
 	Dispatch func(context.Context, *runnerv1.Task) error
 
 	sync.Mutex
 	routineGroup *routineGroup
-	metric       *metric
+	metric       Metric
 	ready        chan struct{}
 	workerNum    int
 	tasksVersion atomic.Int64 // tasksVersion used to store the version of the last task fetched from the Gitea.
 	Once         bool
+	Backoff      *Backoff
+	lastFetch    time.Time // lastFetch is the time of the last successful FetchTask call
+	DrainTimeout time.Duration
+	Budget       *Budget // Budget is shared between pollers of the same daemon, nil if unlimited
+	// Limits is shared between pollers of the same daemon for MaxJobs and IdleTimeout, nil is unlimited
+	Limits *Limits
+	// ResourceCheck returns an error while the host has not enough resources to accept a task
+	ResourceCheck func() error
+	resourceErr   string
+	// unauthenticated counts consecutive Unauthenticated responses of FetchTask
+	unauthenticated int
+	drain           chan struct{}
+	drainOnce       sync.Once
+	paused          atomic.Bool
 }
 
 func (p *Poller) schedule() {
@@ -56,6 +95,84 @@ func (p *Poller) schedule() {
 	}
 }
 
+// checkResources logs when the host runs out of resources and when it recovers
+func (p *Poller) checkResources(l log.FieldLogger) bool {
+	if p.ResourceCheck == nil {
+		return true
+	}
+	err := p.ResourceCheck()
+	if err == nil {
+		if p.resourceErr != "" {
+			l.Info("resources available again, fetching tasks")
+			p.resourceErr = ""
+		}
+		return true
+	}
+	if msg := err.Error(); msg != p.resourceErr {
+		l.Warnf("not fetching tasks: %s", strings.ReplaceAll(msg, "\n", ", "))
+		p.resourceErr = msg
+	}
+	return false
+}
+
+// budgetReleased returns a nil channel without a shared budget
+func (p *Poller) budgetReleased() <-chan struct{} {
+	if p.Budget == nil {
+		return nil
+	}
+	return p.Budget.Released()
+}
+
+// WorkerNum returns the capacity
+func (p *Poller) WorkerNum() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.workerNum
+}
+
+// SetWorkerNum changes the capacity, running tasks are not affected
+func (p *Poller) SetWorkerNum(workerNum int) {
+	p.Lock()
+	p.workerNum = workerNum
+	p.Unlock()
+	p.schedule()
+}
+
+// Pause stops fetching new tasks until Resume, running tasks are not affected
+func (p *Poller) Pause() {
+	if !p.paused.Swap(true) {
+		log.Info("poller: paused, not fetching tasks")
+	}
+}
+
+// Resume fetches tasks again after Pause
+func (p *Poller) Resume() {
+	if p.paused.Swap(false) {
+		log.Info("poller: resumed, fetching tasks")
+	}
+}
+
+// Paused reports whether fetching tasks is paused
+func (p *Poller) Paused() bool {
+	return p.paused.Load()
+}
+
+// Drain stops fetching new tasks and lets running tasks finish,
+// tasks still running after DrainTimeout are cancelled
+func (p *Poller) Drain() {
+	p.drainOnce.Do(func() {
+		close(p.drain)
+	})
+}
+
+// shutdown cancels all running tasks
+func (p *Poller) shutdown(l log.FieldLogger, hardCancel context.CancelFunc, reason string) {
+	if n := p.metric.BusyWorkers(); n > 0 {
+		l.Warnf("runner shutting down: %s, cancelling %d running tasks", reason, n)
+	}
+	hardCancel()
+}
+
 func (p *Poller) Wait() {
 	p.routineGroup.Wait()
 	defer log.Infof("wait: exit")
@@ -72,12 +189,20 @@ func (p *Poller) Poll(rootctx context.Context) error {
 	// trap Ctrl+C to control graceful exit of running jobs
 	channel := make(chan os.Signal, 1)
 	signal.Notify(channel, syscall.SIGTERM, os.Interrupt)
+	drainChannel := make(chan os.Signal, 1)
+	if len(drainSignals) > 0 {
+		signal.Notify(drainChannel, drainSignals...)
+	}
+
+	l := log.WithField("func", "Poll")
 
 	defer func() {
 		p.Wait()
 		hardCancel()
 		signal.Stop(channel)
 		close(channel)
+		signal.Stop(drainChannel)
+		close(drainChannel)
 	}()
 
 	go func() {
@@ -85,15 +210,43 @@ func (p *Poller) Poll(rootctx context.Context) error {
 		// follow github-act-runner behavior
 		// sigterm will cancel all running jobs
 		if sig == syscall.SIGTERM || !ok {
-			hardCancel()
+			p.shutdown(l, hardCancel, "received "+fmt.Sprint(sig))
 			return
 		}
 		// now a second signal always terminates the job
-		<-channel
-		hardCancel()
+		if _, ok := <-channel; ok {
+			p.shutdown(l, hardCancel, "received a second interrupt")
+		}
 	}()
 
-	l := log.WithField("func", "Poll")
+	go func() {
+		if _, ok := <-drainChannel; ok {
+			p.Drain()
+		}
+	}()
+
+	go func() {
+		select {
+		case <-p.drain:
+		case <-jobCtx.Done():
+			return
+		}
+		l.Infof("drain: stop fetching new tasks, waiting for %d running tasks", p.metric.BusyWorkers())
+		cancel()
+		if p.DrainTimeout <= 0 {
+			return
+		}
+		select {
+		case <-time.After(p.DrainTimeout):
+			p.shutdown(l, hardCancel, fmt.Sprintf("drain timeout of %v reached", p.DrainTimeout))
+		case <-jobCtx.Done():
+		}
+	}()
+
+	p.lastFetch = time.Now()
+	if p.Limits == nil {
+		p.Limits = NewLimits(0, 0)
+	}
 
 	for {
 		// check worker number
@@ -102,6 +255,9 @@ func (p *Poller) Poll(rootctx context.Context) error {
 		select {
 		// wait worker ready
 		case <-p.ready:
+		case <-p.budgetReleased():
+			// a task of another poller finished
+			continue
 		case <-ctx.Done():
 			log.Infof("Poll: exit -1")
 			return nil
@@ -112,23 +268,102 @@ func (p *Poller) Poll(rootctx context.Context) error {
 			case <-ctx.Done():
 				break LOOP
 			default:
+				if p.paused.Load() {
+					select {
+					case <-ctx.Done():
+						break LOOP
+					case <-time.After(time.Second):
+					}
+					break
+				}
+				if !p.checkResources(l) {
+					select {
+					case <-ctx.Done():
+						break LOOP
+					case <-time.After(fetchInterval):
+					}
+					break
+				}
+				if p.Budget != nil && !p.Budget.TryAcquire() {
+					// all shared slots are used by other pollers
+					select {
+					case <-ctx.Done():
+						break LOOP
+					case <-p.Budget.Released():
+					}
+					break
+				}
+				if ok, err := p.Limits.Reserve(); !ok {
+					if p.Budget != nil {
+						p.Budget.Release()
+					}
+					if err != nil {
+						l.Infof("%d tasks have been fetched, stop polling after completion", p.Limits.MaxJobs)
+						return err
+					}
+					// the remaining jobs are reserved by other pollers
+					select {
+					case <-ctx.Done():
+						break LOOP
+					case <-p.Limits.Changed():
+					}
+					break
+				}
 				task, err := p.pollTask(ctx)
 				if task == nil || err != nil {
-					if err != nil {
-						l.Errorf("can't find the task: %v", err.Error())
+					p.Limits.Unreserve()
+					if p.Budget != nil {
+						// give other pollers the chance to fetch a task
+						p.Budget.Release()
+					}
+					if p.Limits.Idle() {
+						l.Infof("no task fetched for %v, stop polling", p.Limits.IdleTimeout)
+						return ErrIdleTimeout
+					}
+					delay := fetchInterval
+					if err == nil {
+						p.unauthenticated = 0
+					} else {
+						if connect.CodeOf(err) == connect.CodeUnauthenticated {
+							p.unauthenticated++
+							if p.unauthenticated >= maxUnauthenticated {
+								l.WithError(err).Errorf("runner is not authenticated after %d attempts, stop polling", p.unauthenticated)
+								return fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+							}
+						} else {
+							p.unauthenticated = 0
+						}
+						switch connect.CodeOf(err) {
+						case connect.CodeUnavailable, connect.CodeDeadlineExceeded:
+							// only back off while the server is not reachable
+							delay = p.Backoff.Next()
+							l.WithField("failures", p.Backoff.Attempts()).
+								WithField("unreachable", time.Since(p.lastFetch).Round(time.Second)).
+								WithField("retry", delay.Round(time.Millisecond)).
+								Errorf("can't find the task: %v", err.Error())
+						default:
+							l.Errorf("can't find the task: %v", err.Error())
+						}
 					}
 					select {
 					case <-ctx.Done():
 						break LOOP
-					case <-time.After(5 * time.Second):
+					case <-time.After(delay):
 					}
 					break
 				}
 
+				p.unauthenticated = 0
+				last := p.Limits.Started()
+				p.metric.TaskStarted()
 				p.metric.IncBusyWorker()
 				p.routineGroup.Run(func() {
 					defer p.schedule()
 					defer p.metric.DecBusyWorker()
+					defer p.Limits.Finished()
+					if p.Budget != nil {
+						defer p.Budget.Release()
+					}
 					if p.Once {
 						defer l.Infof("execute task: once")
 						defer cancel()
@@ -139,6 +374,10 @@ func (p *Poller) Poll(rootctx context.Context) error {
 						l.Infof("execute task: ok")
 					}
 				})
+				if last {
+					l.Infof("fetched %d tasks, stop polling after completion", p.Limits.MaxJobs)
+					return ErrMaxJobsReached
+				}
 				break LOOP
 			}
 		}
@@ -156,10 +395,14 @@ func (p *Poller) pollTask(ctx context.Context) (*runnerv1.Task, error) {
 	reqCtx, cancel := context.WithTimeout(ctx, 50*time.Second)
 	defer cancel()
 
+	start := time.Now()
 	resp, err := p.Client.FetchTask(reqCtx, connect.NewRequest(&runnerv1.FetchTaskRequest{
 		TasksVersion: v,
 	}))
-	if err == context.Canceled || err == context.DeadlineExceeded {
+	if ctx.Err() == nil {
+		p.metric.ObserveFetchTask(time.Since(start), err)
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded || ctx.Err() != nil {
 		l.WithError(err).Trace("poller: no stage returned")
 		return nil, nil
 	}
@@ -170,10 +413,21 @@ func (p *Poller) pollTask(ctx context.Context) (*runnerv1.Task, error) {
 	}
 
 	if err != nil {
-		l.WithError(err).Error("cannot accept task")
+		switch connect.CodeOf(err) {
+		case connect.CodeUnavailable, connect.CodeDeadlineExceeded:
+			l.WithError(err).Debug("server not reachable")
+		default:
+			l.WithError(err).Error("cannot accept task")
+		}
 		return nil, err
 	}
 
+	if p.Backoff.Attempts() > 0 {
+		l.Infof("poller: server reachable again after %d failures and %v", p.Backoff.Attempts(), time.Since(p.lastFetch).Round(time.Second))
+	}
+	p.Backoff.Reset()
+	p.lastFetch = time.Now()
+
 	// exit if a nil or empty stage is returned from the system
 	// and allow the runner to retry.
 	if resp == nil || resp.Msg == nil {
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package poller
+
+import (
+	"os"
+	"syscall"
+)
+
+// drainSignals start the graceful drain of the poller
+var drainSignals = []os.Signal{syscall.SIGUSR1}
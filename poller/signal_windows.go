@@ -0,0 +1,8 @@
+package poller
+
+import (
+	"os"
+)
+
+// drainSignals start the graceful drain of the poller, windows has no SIGUSR1
+var drainSignals = []os.Signal{}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"os"
-	"strings"
 
 	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
 	"github.com/ChristopherHX/gitea-actions-runner/client"
 	"github.com/ChristopherHX/gitea-actions-runner/config"
 	"github.com/ChristopherHX/gitea-actions-runner/core"
+	"github.com/ChristopherHX/gitea-actions-runner/labels"
 
 	"connectrpc.com/connect"
 	log "github.com/sirupsen/logrus"
@@ -26,15 +26,11 @@ type Register struct {
 }
 
 func (p *Register) Register(ctx context.Context, cfg config.Runner) (*core.Runner, error) {
-	labels := make([]string, len(cfg.Labels))
-	for i, v := range cfg.Labels {
-		labels[i] = strings.SplitN(v, ":", 2)[0]
-	}
 	// register new runner.
 	resp, err := p.Client.Register(ctx, connect.NewRequest(&runnerv1.RegisterRequest{
 		Name:        cfg.Name,
 		Token:       cfg.Token,
-		AgentLabels: labels,
+		AgentLabels: labels.Names(cfg.Labels),
 		Ephemeral:   cfg.Ephemeral,
 	}))
 	if err != nil {
@@ -50,6 +46,7 @@ func (p *Register) Register(ctx context.Context, cfg config.Runner) (*core.Runne
 		Address:      p.Client.Address(),
 		RunnerWorker: cfg.RunnerWorker,
 		Labels:       cfg.Labels,
+		Capacity:     cfg.Capacity,
 		Ephemeral:    resp.Msg.Runner.Ephemeral,
 	}
 
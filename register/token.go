@@ -0,0 +1,98 @@
+package register
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+)
+
+// registrationTokenURLs returns the api endpoints of the registration token in the order they are tried
+func registrationTokenURLs(instance, owner, repo string) []string {
+	api := strings.TrimRight(instance, "/") + "/api/v1"
+	switch {
+	case owner != "" && repo != "":
+		return []string{fmt.Sprintf("%s/repos/%s/%s/actions/runners/registration-token", api, url.PathEscape(owner), url.PathEscape(repo))}
+	case owner != "":
+		// owner is either an organization or the user of the token
+		return []string{
+			fmt.Sprintf("%s/orgs/%s/actions/runners/registration-token", api, url.PathEscape(owner)),
+			api + "/user/actions/runners/registration-token",
+		}
+	default:
+		return []string{api + "/admin/runners/registration-token"}
+	}
+}
+
+// FetchRegistrationToken requests a runner registration token via the Gitea REST API using a personal access token,
+// an empty owner registers an instance wide runner
+func FetchRegistrationToken(ctx context.Context, instance, pat, owner, repo string) (string, error) {
+	var lastErr error
+	for _, u := range registrationTokenURLs(instance, owner, repo) {
+		// newer Gitea versions use POST, older ones GET
+		for _, method := range []string{http.MethodPost, http.MethodGet} {
+			token, status, err := requestRegistrationToken(ctx, method, u, pat)
+			if err == nil {
+				return token, nil
+			}
+			lastErr = err
+			if status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+				return "", err
+			}
+		}
+	}
+	return "", lastErr
+}
+
+func requestRegistrationToken(ctx context.Context, method, u, pat string) (string, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "token "+pat)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", resp.StatusCode, fmt.Errorf("failed to fetch the registration token from %s %s: %s %s", method, u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var data struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", resp.StatusCode, err
+	}
+	if data.Token == "" {
+		return "", resp.StatusCode, fmt.Errorf("empty registration token returned by %s", u)
+	}
+	return data.Token, resp.StatusCode, nil
+}
+
+// RegistrationToken returns the registration token of the configured source,
+// a personal access token requests a new token from the instance
+func RegistrationToken(ctx context.Context, instance string, cfg config.Runner) (string, error) {
+	switch {
+	case cfg.RegistrationToken != "":
+		return cfg.RegistrationToken, nil
+	case cfg.RegistrationTokenFile != "":
+		content, err := os.ReadFile(cfg.RegistrationTokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	case cfg.PAT != "":
+		return FetchRegistrationToken(ctx, instance, cfg.PAT, cfg.Owner, cfg.Repo)
+	default:
+		return "", fmt.Errorf("no registration token source, set GITEA_RUNNER_REGISTRATION_TOKEN, GITEA_RUNNER_REGISTRATION_TOKEN_FILE or GITEA_RUNNER_PAT")
+	}
+}
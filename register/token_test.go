@@ -0,0 +1,54 @@
+package register
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchRegistrationToken(t *testing.T) {
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/repos/owner/repo/actions/runners/registration-token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token pat" {
+			http.Error(w, `{"message":"token is required"}`, http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"repo-token"}`))
+	})
+	// older Gitea versions only know GET
+	mux.HandleFunc("GET /api/v1/user/actions/runners/registration-token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"token":"user-token"}`))
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	token, err := FetchRegistrationToken(ctx, server.URL+"/", "pat", "owner", "repo")
+	assert.NoError(t, err)
+	assert.Equal(t, "repo-token", token)
+
+	// the owner is no organization, the user endpoint is used
+	requests = nil
+	token, err = FetchRegistrationToken(ctx, server.URL, "pat", "user", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-token", token)
+	assert.Equal(t, []string{
+		"POST /api/v1/orgs/user/actions/runners/registration-token",
+		"GET /api/v1/orgs/user/actions/runners/registration-token",
+		"POST /api/v1/user/actions/runners/registration-token",
+		"GET /api/v1/user/actions/runners/registration-token",
+	}, requests)
+
+	// an invalid token is not retried with other endpoints
+	requests = nil
+	_, err = FetchRegistrationToken(ctx, server.URL, "invalid", "owner", "repo")
+	assert.ErrorContains(t, err, "401 Unauthorized")
+	assert.Len(t, requests, 1)
+}
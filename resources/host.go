@@ -0,0 +1,11 @@
+//go:build !linux
+
+package resources
+
+func availableMemory() (uint64, error) {
+	return 0, errUnsupported
+}
+
+func loadAverage() (float64, error) {
+	return 0, errUnsupported
+}
@@ -0,0 +1,61 @@
+package resources
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func availableMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseMeminfo(f)
+}
+
+// parseMeminfo returns MemAvailable of /proc/meminfo in bytes
+func parseMeminfo(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// MemAvailable:    1234567 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemAvailable missing in /proc/meminfo")
+}
+
+func loadAverage() (float64, error) {
+	f, err := os.Open("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseLoadavg(f)
+}
+
+// parseLoadavg returns the load average of the last minute of /proc/loadavg
+func parseLoadavg(r io.Reader) (float64, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg content %q", content)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,32 @@
+package resources
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMeminfo(t *testing.T) {
+	free, err := parseMeminfo(strings.NewReader(`MemTotal:       16318480 kB
+MemFree:         1022840 kB
+MemAvailable:    8154232 kB
+Buffers:          412812 kB
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(8154232*1024), free)
+
+	_, err = parseMeminfo(strings.NewReader("MemTotal:       16318480 kB\n"))
+	assert.ErrorContains(t, err, "MemAvailable missing")
+	_, err = parseMeminfo(strings.NewReader("MemAvailable:    many kB\n"))
+	assert.Error(t, err)
+}
+
+func TestParseLoadavg(t *testing.T) {
+	load, err := parseLoadavg(strings.NewReader("1.52 0.98 0.61 2/1024 12345\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.52, load)
+
+	_, err = parseLoadavg(strings.NewReader(""))
+	assert.ErrorContains(t, err, "unexpected /proc/loadavg content")
+}
@@ -0,0 +1,120 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errUnsupported is returned by probes not available on this platform
+var errUnsupported = errors.New("not supported on " + runtime.GOOS)
+
+const mb = 1024 * 1024
+
+// Thresholds describes the minimum resources required to accept a new task
+type Thresholds struct {
+	// Dirs are checked for MinFreeDiskMB, for example the work and cache directory
+	Dirs            []string
+	MinFreeDiskMB   uint64
+	MinFreeMemoryMB uint64
+	MaxLoad         float64
+	// CleanupCommand is executed by the shell once a threshold is breached
+	CleanupCommand string
+
+	mu        sync.Mutex
+	breached  bool
+	warnOnce  sync.Once
+	unsupport []string
+}
+
+// FreeDiskMB returns the free disk of the filesystem containing dir
+func FreeDiskMB(dir string) (uint64, error) {
+	free, err := freeDisk(dir)
+	return free / mb, err
+}
+
+// Enabled reports whether any threshold is configured
+func (t *Thresholds) Enabled() bool {
+	return t.MinFreeDiskMB > 0 || t.MinFreeMemoryMB > 0 || t.MaxLoad > 0
+}
+
+// Check returns an error describing all breached thresholds,
+// the cleanup command runs before the thresholds are checked again
+func (t *Thresholds) Check() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.check()
+	if err != nil && !t.breached && t.CleanupCommand != "" {
+		log.WithError(err).Infof("resources: running cleanup command %q", t.CleanupCommand)
+		if cerr := runCleanup(t.CleanupCommand); cerr != nil {
+			log.WithError(cerr).Error("resources: cleanup command failed")
+		}
+		err = t.check()
+	}
+	t.breached = err != nil
+	t.warnOnce.Do(func() {
+		if len(t.unsupport) > 0 {
+			log.Warnf("resources: %s", strings.Join(t.unsupport, ", "))
+		}
+	})
+	return err
+}
+
+func (t *Thresholds) check() error {
+	t.unsupport = nil
+	var errs []error
+	if t.MinFreeDiskMB > 0 {
+		for _, dir := range t.Dirs {
+			if _, err := os.Stat(dir); err != nil {
+				continue
+			}
+			free, err := freeDisk(dir)
+			if err != nil {
+				t.unsupport = append(t.unsupport, fmt.Sprintf("free disk of %s: %v", dir, err))
+				continue
+			}
+			if free < t.MinFreeDiskMB*mb {
+				errs = append(errs, fmt.Errorf("free disk of %s is %d MB, required %d MB", dir, free/mb, t.MinFreeDiskMB))
+			}
+		}
+	}
+	if t.MinFreeMemoryMB > 0 {
+		free, err := availableMemory()
+		if err != nil {
+			t.unsupport = append(t.unsupport, fmt.Sprintf("available memory: %v", err))
+		} else if free < t.MinFreeMemoryMB*mb {
+			errs = append(errs, fmt.Errorf("available memory is %d MB, required %d MB", free/mb, t.MinFreeMemoryMB))
+		}
+	}
+	if t.MaxLoad > 0 {
+		load, err := loadAverage()
+		if err != nil {
+			t.unsupport = append(t.unsupport, fmt.Sprintf("load average: %v", err))
+		} else if load > t.MaxLoad {
+			errs = append(errs, fmt.Errorf("load average is %.2f, allowed %.2f", load, t.MaxLoad))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runCleanup(command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,57 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholdsCheck(t *testing.T) {
+	dir := t.TempDir()
+	th := &Thresholds{Dirs: []string{dir, filepath.Join(dir, "missing")}}
+	assert.False(t, th.Enabled())
+	assert.NoError(t, th.Check())
+
+	th.MinFreeDiskMB = 1
+	assert.True(t, th.Enabled())
+	assert.NoError(t, th.Check())
+
+	th.MinFreeDiskMB = 1 << 40
+	err := th.Check()
+	assert.ErrorContains(t, err, "free disk of "+dir)
+	// missing directories are skipped
+	assert.NotContains(t, err.Error(), "missing")
+}
+
+func TestThresholdsCleanupOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the cleanup command uses sh")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	th := &Thresholds{
+		Dirs:           []string{dir},
+		MinFreeDiskMB:  1 << 40,
+		CleanupCommand: "echo cleanup >> " + calls,
+	}
+	count := func() int {
+		content, _ := os.ReadFile(calls)
+		return strings.Count(string(content), "cleanup")
+	}
+	assert.Error(t, th.Check())
+	assert.Equal(t, 1, count())
+	// the cleanup command runs once while the threshold is breached
+	assert.Error(t, th.Check())
+	assert.Error(t, th.Check())
+	assert.Equal(t, 1, count())
+
+	th.MinFreeDiskMB = 1
+	assert.NoError(t, th.Check())
+	th.MinFreeDiskMB = 1 << 40
+	assert.Error(t, th.Check())
+	assert.Equal(t, 2, count())
+}
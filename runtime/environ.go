@@ -0,0 +1,56 @@
+package runtime
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/ChristopherHX/github-act-runner/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// jobEnviron merges the runner environment with the overlays of the runs-on labels,
+// later labels take precedence
+func jobEnviron(envs map[string]string, labelEnvs map[string]map[string]string, runsOn []string) map[string]string {
+	environ := maps.Clone(envs)
+	if environ == nil {
+		environ = map[string]string{}
+	}
+	for _, label := range runsOn {
+		maps.Copy(environ, labelEnvs[label])
+	}
+	return environ
+}
+
+// environToken converts the environment to a mapping of literals,
+// values are not evaluated as expressions
+func environToken(environ map[string]string) *protocol.TemplateToken {
+	entries := make([]protocol.MapEntry, 0, len(environ))
+	for _, k := range slices.Sorted(maps.Keys(environ)) {
+		key, value := k, environ[k]
+		entries = append(entries, protocol.MapEntry{
+			Key:   &protocol.TemplateToken{Type: 0, Lit: &key},
+			Value: &protocol.TemplateToken{Type: 0, Lit: &value},
+		})
+	}
+	return &protocol.TemplateToken{Type: 2, Map: &entries}
+}
+
+// jobEnvironments returns the env layers of the job, later layers take precedence:
+// the runner environment is the base layer, followed by the workflow and the job env
+func jobEnvironments(environ map[string]string, workflowEnv map[string]string, jobEnv yaml.Node) []protocol.TemplateToken {
+	envs := []protocol.TemplateToken{}
+	if len(environ) > 0 {
+		envs = append(envs, *environToken(environ))
+	}
+	if len(workflowEnv) > 0 {
+		node := yaml.Node{}
+		node.Encode(workflowEnv)
+		if d := ToTemplateToken(node); d != nil {
+			envs = append(envs, *d)
+		}
+	}
+	if d := ToTemplateToken(jobEnv); d != nil && !jobEnv.IsZero() {
+		envs = append(envs, *d)
+	}
+	return envs
+}
@@ -0,0 +1,98 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/ChristopherHX/github-act-runner/protocol"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// mergeEnvironments applies the env layers like the worker, later layers take precedence
+func mergeEnvironments(t *testing.T, envs []protocol.TemplateToken) map[string]string {
+	environ := map[string]string{}
+	for _, env := range envs {
+		if !assert.NotNil(t, env.Map) {
+			continue
+		}
+		for _, entry := range *env.Map {
+			environ[*entry.Key.Lit] = *entry.Value.Lit
+		}
+	}
+	return environ
+}
+
+func TestJobEnvironments(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		envs        map[string]string
+		labelEnvs   map[string]map[string]string
+		runsOn      []string
+		workflowEnv map[string]string
+		jobEnv      string
+		layers      int
+		expected    map[string]string
+	}{
+		{
+			name:     "empty",
+			expected: map[string]string{},
+		},
+		{
+			name:     "runner env",
+			envs:     map[string]string{"A": "runner", "B": "${{ not evaluated }}"},
+			layers:   1,
+			expected: map[string]string{"A": "runner", "B": "${{ not evaluated }}"},
+		},
+		{
+			name:      "label overlay",
+			envs:      map[string]string{"A": "runner", "B": "runner"},
+			labelEnvs: map[string]map[string]string{"ubuntu": {"A": "ubuntu"}, "windows": {"B": "windows"}},
+			runsOn:    []string{"ubuntu", "unknown"},
+			layers:    1,
+			expected:  map[string]string{"A": "ubuntu", "B": "runner"},
+		},
+		{
+			name:      "later labels take precedence",
+			labelEnvs: map[string]map[string]string{"a": {"A": "a", "B": "a"}, "b": {"A": "b"}},
+			runsOn:    []string{"a", "b"},
+			layers:    1,
+			expected:  map[string]string{"A": "b", "B": "a"},
+		},
+		{
+			name:        "workflow env",
+			envs:        map[string]string{"A": "runner", "B": "runner"},
+			labelEnvs:   map[string]map[string]string{"ubuntu": {"B": "ubuntu", "C": "ubuntu"}},
+			runsOn:      []string{"ubuntu"},
+			workflowEnv: map[string]string{"B": "workflow"},
+			layers:      2,
+			expected:    map[string]string{"A": "runner", "B": "workflow", "C": "ubuntu"},
+		},
+		{
+			name:        "job env",
+			envs:        map[string]string{"A": "runner", "B": "runner", "C": "runner"},
+			workflowEnv: map[string]string{"B": "workflow", "C": "workflow"},
+			jobEnv:      "C: job",
+			layers:      3,
+			expected:    map[string]string{"A": "runner", "B": "workflow", "C": "job"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			jobEnv := yaml.Node{}
+			if tc.jobEnv != "" {
+				doc := yaml.Node{}
+				assert.NoError(t, yaml.Unmarshal([]byte(tc.jobEnv), &doc))
+				jobEnv = *doc.Content[0]
+			}
+			envs := jobEnvironments(jobEnviron(tc.envs, tc.labelEnvs, tc.runsOn), tc.workflowEnv, jobEnv)
+			assert.Len(t, envs, tc.layers)
+			assert.Equal(t, tc.expected, mergeEnvironments(t, envs))
+		})
+	}
+}
+
+func TestJobEnvironUnchanged(t *testing.T) {
+	envs := map[string]string{"A": "runner"}
+	jobEnviron(envs, map[string]map[string]string{"ubuntu": {"A": "ubuntu"}}, []string{"ubuntu"})
+	// the runner environment is shared by all tasks
+	assert.Equal(t, map[string]string{"A": "runner"}, envs)
+}
@@ -0,0 +1,263 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"github.com/ChristopherHX/gitea-actions-runner/client"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"connectrpc.com/connect"
+	log "github.com/sirupsen/logrus"
+)
+
+// JournalEntry is the persisted state of an accepted task
+type JournalEntry struct {
+	TaskID    int64           `json:"task_id"`
+	StartedAt time.Time       `json:"started_at"`
+	LogIndex  int64           `json:"log_index"`
+	CloneDir  string          `json:"clone_dir,omitempty"`
+	State     json.RawMessage `json:"state,omitempty"`
+}
+
+// Journal persists the accepted tasks of a runner on disk,
+// tasks left behind by a crashed daemon are reported as failed on the next start.
+// All methods of a nil Journal are no-ops.
+type Journal struct {
+	Dir string
+
+	mu      sync.Mutex
+	entries map[int64]*JournalEntry
+}
+
+// NewJournal creates the journal directory
+func NewJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Journal{
+		Dir:     dir,
+		entries: map[int64]*JournalEntry{},
+	}, nil
+}
+
+func (j *Journal) path(taskID int64) string {
+	return filepath.Join(j.Dir, fmt.Sprintf("%d.json", taskID))
+}
+
+// write replaces the entry atomically, the caller holds the lock
+func (j *Journal) write(entry *JournalEntry) {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		log.WithError(err).Error("journal: cannot marshal entry")
+		return
+	}
+	tmp := j.path(entry.TaskID) + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		log.WithError(err).Error("journal: cannot write entry")
+		return
+	}
+	if err := os.Rename(tmp, j.path(entry.TaskID)); err != nil {
+		log.WithError(err).Error("journal: cannot write entry")
+	}
+}
+
+// Add records an accepted task
+func (j *Journal) Add(taskID int64) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := &JournalEntry{
+		TaskID:    taskID,
+		StartedAt: time.Now(),
+	}
+	j.entries[taskID] = entry
+	j.write(entry)
+}
+
+// update changes an entry and persists it
+func (j *Journal) update(taskID int64, fn func(entry *JournalEntry) bool) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := j.entries[taskID]
+	if !ok || !fn(entry) {
+		return
+	}
+	j.write(entry)
+}
+
+// SetLogIndex records the amount of log rows acknowledged by the server
+func (j *Journal) SetLogIndex(taskID int64, index int64) {
+	j.update(taskID, func(entry *JournalEntry) bool {
+		if entry.LogIndex == index {
+			return false
+		}
+		entry.LogIndex = index
+		return true
+	})
+}
+
+// SetCloneDir records the runner directory created for the task
+func (j *Journal) SetCloneDir(taskID int64, dir string) {
+	j.update(taskID, func(entry *JournalEntry) bool {
+		entry.CloneDir = dir
+		return true
+	})
+}
+
+// SetState records the last state reported to the server
+func (j *Journal) SetState(state *runnerv1.TaskState) {
+	j.update(state.GetId(), func(entry *JournalEntry) bool {
+		content, err := protojson.Marshal(state)
+		if err != nil {
+			return false
+		}
+		entry.State = content
+		return true
+	})
+}
+
+// Remove deletes a finished task
+func (j *Journal) Remove(taskID int64) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.entries, taskID)
+	if err := os.Remove(j.path(taskID)); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Error("journal: cannot remove entry")
+	}
+}
+
+// Running returns the clone directories of running tasks
+func (j *Journal) Running() []string {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	dirs := []string{}
+	for _, entry := range j.entries {
+		if entry.CloneDir != "" {
+			dirs = append(dirs, entry.CloneDir)
+		}
+	}
+	return dirs
+}
+
+// CloneDirs returns the clone directories recorded below the journal directory of all registrations,
+// they belong to running tasks or to tasks of a crashed daemon which have not been reported yet
+func CloneDirs(dir string) ([]string, error) {
+	dirs := []string{}
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		entry := &JournalEntry{}
+		if err := json.Unmarshal(content, entry); err == nil && entry.CloneDir != "" {
+			dirs = append(dirs, entry.CloneDir)
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// Recover reports the tasks of a previous daemon as failed and removes their clone directories
+func (j *Journal) Recover(ctx context.Context, cli client.Client) {
+	if j == nil {
+		return
+	}
+	files, err := os.ReadDir(j.Dir)
+	if err != nil {
+		log.WithError(err).Error("journal: cannot read journal")
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		p := filepath.Join(j.Dir, file.Name())
+		content, err := os.ReadFile(p)
+		if err != nil {
+			log.WithError(err).Errorf("journal: cannot read %s", p)
+			continue
+		}
+		entry := &JournalEntry{}
+		if err := json.Unmarshal(content, entry); err != nil {
+			log.WithError(err).Errorf("journal: removing invalid entry %s", p)
+			_ = os.Remove(p)
+			continue
+		}
+		if err := recoverTask(ctx, cli, entry); err != nil {
+			log.WithError(err).Errorf("journal: cannot report orphaned task %d, retrying on next start", entry.TaskID)
+			continue
+		}
+		if entry.CloneDir != "" {
+			_ = os.RemoveAll(entry.CloneDir)
+		}
+		_ = os.Remove(p)
+	}
+}
+
+func recoverTask(ctx context.Context, cli client.Client, entry *JournalEntry) error {
+	log.Infof("journal: reporting orphaned task %d started at %v as failed", entry.TaskID, entry.StartedAt.Format(time.RFC3339))
+	message := fmt.Sprintf("##[Error]The runner has been restarted while running this job, the job started at %s has been aborted", entry.StartedAt.Format(time.RFC3339))
+	_, err := cli.UpdateLog(ctx, connect.NewRequest(&runnerv1.UpdateLogRequest{
+		TaskId: entry.TaskID,
+		Index:  entry.LogIndex,
+		Rows: []*runnerv1.LogRow{
+			{
+				Time:    timestamppb.Now(),
+				Content: message,
+			},
+		},
+		NoMore: true,
+	}))
+	if err != nil && !isUnauthenticatedError(err) {
+		return err
+	}
+
+	state := &runnerv1.TaskState{}
+	if len(entry.State) > 0 {
+		_ = protojson.Unmarshal(entry.State, state)
+	}
+	state.Id = entry.TaskID
+	if state.StartedAt == nil {
+		state.StartedAt = timestamppb.New(entry.StartedAt)
+	}
+	state.Result = runnerv1.Result_RESULT_FAILURE
+	state.StoppedAt = timestamppb.Now()
+	checkIntegrity(state)
+	_, err = cli.UpdateTask(ctx, connect.NewRequest(&runnerv1.UpdateTaskRequest{
+		State: state,
+	}))
+	if isUnauthenticatedError(err) {
+		// the task has already been finished by the server
+		return nil
+	}
+	return err
+}
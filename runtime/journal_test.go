@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"github.com/ChristopherHX/gitea-actions-runner/client"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/assert"
+)
+
+// journalClient records the reports of recovered tasks, failing is reported as unavailable
+type journalClient struct {
+	client.Client
+	failing int64
+	logs    []*runnerv1.UpdateLogRequest
+	tasks   []*runnerv1.UpdateTaskRequest
+}
+
+func (c *journalClient) Address() string {
+	return "https://gitea.example"
+}
+
+func (c *journalClient) UpdateLog(ctx context.Context, req *connect.Request[runnerv1.UpdateLogRequest]) (*connect.Response[runnerv1.UpdateLogResponse], error) {
+	if req.Msg.TaskId == c.failing {
+		return nil, connect.NewError(connect.CodeUnavailable, errors.New("server not reachable"))
+	}
+	c.logs = append(c.logs, req.Msg)
+	return connect.NewResponse(&runnerv1.UpdateLogResponse{}), nil
+}
+
+func (c *journalClient) UpdateTask(ctx context.Context, req *connect.Request[runnerv1.UpdateTaskRequest]) (*connect.Response[runnerv1.UpdateTaskResponse], error) {
+	c.tasks = append(c.tasks, req.Msg)
+	return connect.NewResponse(&runnerv1.UpdateTaskResponse{}), nil
+}
+
+func TestJournal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "uuid")
+	j, err := NewJournal(dir)
+	assert.NoError(t, err)
+	clone := filepath.Join(t.TempDir(), "runner-1")
+
+	j.Add(1)
+	j.SetLogIndex(1, 5)
+	j.SetCloneDir(1, clone)
+	j.SetState(&runnerv1.TaskState{Id: 1, Steps: []*runnerv1.StepState{{Id: 0, Result: runnerv1.Result_RESULT_SUCCESS}}})
+	j.Add(2)
+	// unknown tasks are ignored
+	j.SetLogIndex(3, 1)
+	_, err = os.Stat(filepath.Join(dir, "3.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, []string{clone}, j.Running())
+	dirs, err := CloneDirs(filepath.Dir(dir))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{clone}, dirs)
+
+	j.Remove(2)
+	_, err = os.Stat(filepath.Join(dir, "2.json"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "1.json"))
+	assert.NoError(t, err)
+
+	// all methods of a nil journal are no-ops
+	var nilJournal *Journal
+	nilJournal.Add(1)
+	nilJournal.SetLogIndex(1, 1)
+	nilJournal.Remove(1)
+	assert.Empty(t, nilJournal.Running())
+}
+
+func TestJournalRecover(t *testing.T) {
+	dir := t.TempDir()
+	clone := filepath.Join(t.TempDir(), "runner-1")
+	assert.NoError(t, os.MkdirAll(clone, 0o755))
+
+	// the daemon crashes while running task 1 and 2
+	crashed, err := NewJournal(dir)
+	assert.NoError(t, err)
+	crashed.Add(1)
+	crashed.SetLogIndex(1, 5)
+	crashed.SetCloneDir(1, clone)
+	crashed.SetState(&runnerv1.TaskState{Id: 1, Steps: []*runnerv1.StepState{{Id: 0, Result: runnerv1.Result_RESULT_SUCCESS}}})
+	crashed.Add(2)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0o600))
+
+	j, err := NewJournal(dir)
+	assert.NoError(t, err)
+	cli := &journalClient{failing: 2}
+	j.Recover(context.Background(), cli)
+
+	if assert.Len(t, cli.logs, 1) {
+		assert.Equal(t, int64(1), cli.logs[0].TaskId)
+		assert.Equal(t, int64(5), cli.logs[0].Index)
+		assert.True(t, cli.logs[0].NoMore)
+	}
+	if assert.Len(t, cli.tasks, 1) {
+		assert.Equal(t, int64(1), cli.tasks[0].State.Id)
+		assert.Equal(t, runnerv1.Result_RESULT_FAILURE, cli.tasks[0].State.Result)
+		assert.Len(t, cli.tasks[0].State.Steps, 1)
+		assert.NotNil(t, cli.tasks[0].State.StoppedAt)
+	}
+	_, err = os.Stat(clone)
+	assert.True(t, os.IsNotExist(err), "clone directory of the orphaned task has not been removed")
+	_, err = os.Stat(filepath.Join(dir, "1.json"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "invalid.json"))
+	assert.True(t, os.IsNotExist(err))
+	// task 2 is reported again on the next start
+	_, err = os.Stat(filepath.Join(dir, "2.json"))
+	assert.NoError(t, err)
+}
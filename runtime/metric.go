@@ -0,0 +1,27 @@
+package runtime
+
+import (
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+)
+
+// Metric receives the reporting events of running tasks
+type Metric interface {
+	TaskFinished(result runnerv1.Result, duration time.Duration)
+	UpdateLogFailed()
+	UpdateTaskFailed()
+	AddBufferedLogRows(delta int64)
+}
+
+var _ Metric = noopMetric{}
+
+type noopMetric struct{}
+
+func (noopMetric) TaskFinished(runnerv1.Result, time.Duration) {}
+
+func (noopMetric) UpdateLogFailed() {}
+
+func (noopMetric) UpdateTaskFailed() {}
+
+func (noopMetric) AddBufferedLogRows(int64) {}
@@ -0,0 +1,56 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// SecretPlaceholder replaces the values of secrets and tokens in recorded tasks
+const SecretPlaceholder = "***"
+
+// recordedTokens are the keys of the task context holding the job token
+var recordedTokens = []string{"token", "gitea_runtime_token"}
+
+// RecordTask writes the task with redacted secrets to dir as task-<id>.json
+func RecordTask(dir string, task *runnerv1.Task) (string, error) {
+	task = proto.Clone(task).(*runnerv1.Task)
+	for k := range task.Secrets {
+		task.Secrets[k] = SecretPlaceholder
+	}
+	if task.Context != nil {
+		for _, k := range recordedTokens {
+			if _, ok := task.Context.Fields[k]; ok {
+				task.Context.Fields[k] = structpb.NewStringValue(SecretPlaceholder)
+			}
+		}
+	}
+	content, err := protojson.MarshalOptions{Multiline: true}.Marshal(task)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("task-%d.json", task.Id))
+	// the payload and the context may contain private data of the repository
+	return file, os.WriteFile(file, content, 0o600)
+}
+
+// ReadTask reads a task written by RecordTask
+func ReadTask(file string) (*runnerv1.Task, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	task := &runnerv1.Task{}
+	if err := protojson.Unmarshal(content, task); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return task, nil
+}
@@ -0,0 +1,46 @@
+package runtime
+
+import (
+	"os"
+	"testing"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestRecordTask(t *testing.T) {
+	context, err := structpb.NewStruct(map[string]any{
+		"repository":          "owner/repo",
+		"token":               "job-token",
+		"gitea_runtime_token": "runtime-token",
+	})
+	assert.NoError(t, err)
+	task := &runnerv1.Task{
+		Id:              42,
+		WorkflowPayload: []byte("on: push\n"),
+		Context:         context,
+		Secrets:         map[string]string{"TOKEN": "top-secret"},
+		Vars:            map[string]string{"NAME": "value"},
+		Needs:           map[string]*runnerv1.TaskNeed{"build": {Result: runnerv1.Result_RESULT_SUCCESS, Outputs: map[string]string{"v": "1"}}},
+	}
+	dir := t.TempDir()
+	file, err := RecordTask(dir, task)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "top-secret")
+	assert.NotContains(t, string(content), "job-token")
+	assert.NotContains(t, string(content), "runtime-token")
+	// the fetched task is unchanged
+	assert.Equal(t, "top-secret", task.Secrets["TOKEN"])
+
+	recorded, err := ReadTask(file)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), recorded.Id)
+	assert.Equal(t, "on: push\n", string(recorded.WorkflowPayload))
+	assert.Equal(t, SecretPlaceholder, recorded.Secrets["TOKEN"])
+	assert.Equal(t, "value", recorded.Vars["NAME"])
+	assert.Equal(t, "owner/repo", recorded.Context.Fields["repository"].GetStringValue())
+	assert.Equal(t, runnerv1.Result_RESULT_SUCCESS, recorded.Needs["build"].Result)
+}
@@ -2,26 +2,73 @@ package runtime
 
 import (
 	"context"
+	"sync"
 
 	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
 	"github.com/ChristopherHX/gitea-actions-runner/client"
+	"github.com/ChristopherHX/gitea-actions-runner/config"
+	"github.com/ChristopherHX/gitea-actions-runner/labels"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // Runner runs the pipeline.
 type Runner struct {
+	mu            sync.RWMutex
 	Machine       string
 	ForgeInstance string
 	Environ       map[string]string
+	LabelEnviron  map[string]map[string]string
 	Client        client.Client
 	Labels        []string
 	RunnerWorker  []string
+	Metric        Metric
+	Journal       *Journal
+	Runtime       config.Runtime
+	Cache         config.Cache
+	Log           config.Log
+	// RecordDir stores each task with redacted secrets, empty disables recording
+	RecordDir string
 }
 
 // Run runs the pipeline stage.
 func (s *Runner) Run(ctx context.Context, task *runnerv1.Task) error {
-	return NewTask(s.ForgeInstance, task.Id, s.Client, s.Environ, s.platformPicker).Run(ctx, task, s.RunnerWorker)
+	s.mu.RLock()
+	environ, labelEnviron, runnerWorker := s.Environ, s.LabelEnviron, s.RunnerWorker
+	s.mu.RUnlock()
+	if s.RecordDir != "" {
+		if file, err := RecordTask(s.RecordDir, task); err != nil {
+			log.WithError(err).Warnf("cannot record task %d", task.Id)
+		} else {
+			log.Infof("recorded task %d to %s", task.Id, file)
+		}
+	}
+	t := NewTask(s.ForgeInstance, task.Id, s.Client, environ, s.platformPicker)
+	t.Input.labelEnvs = labelEnviron
+	if s.Metric != nil {
+		t.metric = s.Metric
+	}
+	t.journal = s.Journal
+	t.Runtime = s.Runtime
+	t.Cache = s.Cache
+	t.Log = s.Log
+	return t.Run(ctx, task, runnerWorker)
+}
+
+// Reload replaces the settings used for subsequently dispatched tasks
+func (s *Runner) Reload(environ map[string]string, labelEnviron map[string]map[string]string, labels []string, runnerWorker []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Environ = environ
+	s.LabelEnviron = labelEnviron
+	s.Labels = labels
+	s.RunnerWorker = runnerWorker
 }
 
-func (s *Runner) platformPicker(labels []string) string {
-	return ""
+// platformPicker returns the default container image for the runs-on labels of a job,
+// an empty string runs the job on the host
+func (s *Runner) platformPicker(runsOn []string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return labels.ParseAll(s.Labels).PickImage(runsOn)
 }
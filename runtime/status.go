@@ -0,0 +1,61 @@
+package runtime
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// TaskStatus describes a running task
+type TaskStatus struct {
+	ID         int64     `json:"id"`
+	Repository string    `json:"repository,omitempty"`
+	Job        string    `json:"job,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	Step       string    `json:"step,omitempty"`
+}
+
+// Status returns the progress of the task
+func (t *Task) Status() TaskStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+func (t *Task) updateStatus(fn func(status *TaskStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.status)
+}
+
+// Cancel stops the task, it is reported as cancelled
+func (t *Task) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+// RunningTasks returns the tasks of all runners ordered by id
+func RunningTasks() []TaskStatus {
+	tasks := []TaskStatus{}
+	globalTaskMap.Range(func(_, value any) bool {
+		tasks = append(tasks, value.(*Task).Status())
+		return true
+	})
+	slices.SortFunc(tasks, func(a, b TaskStatus) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return tasks
+}
+
+// CancelTask cancels a running task, false if the task is not running
+func CancelTask(id int64) bool {
+	value, ok := globalTaskMap.Load(id)
+	if !ok {
+		return false
+	}
+	value.(*Task).Cancel()
+	return true
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -15,14 +16,17 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
 	"github.com/ChristopherHX/gitea-actions-runner/actions/server"
 	"github.com/ChristopherHX/gitea-actions-runner/client"
+	"github.com/ChristopherHX/gitea-actions-runner/config"
 	"github.com/ChristopherHX/gitea-actions-runner/runners"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -43,16 +47,32 @@ import (
 
 var globalTaskMap sync.Map
 
+// ErrJobSkipped is returned by Render mode if the if condition of the job skips it
+var ErrJobSkipped = errors.New("job is skipped")
+
 type TaskInput struct {
 	envs map[string]string
+	// labelEnvs are applied on top of envs for the runs-on labels of the job
+	labelEnvs map[string]map[string]string
 }
 
 type Task struct {
 	BuildID int64
 	Input   *TaskInput
+	Runtime config.Runtime
+	Cache   config.Cache
+	Log     config.Log
+	// Render receives the job request instead of a worker, no listener is opened and nothing is reported
+	Render func(*protocol.AgentJobRequestMessage) error
 
 	client         client.Client
 	platformPicker func([]string) string
+	metric         Metric
+	journal        *Journal
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	status TaskStatus
 }
 
 // NewTask creates a new task
@@ -62,13 +82,44 @@ func NewTask(forgeInstance string, buildID int64, client client.Client, runnerEn
 			envs: runnerEnvs,
 		},
 		BuildID: buildID,
+		Runtime: config.Defaults().Runtime,
 
 		client:         client,
 		platformPicker: picker,
+		metric:         noopMetric{},
 	}
 	return task
 }
 
+// runtimeHostname returns the host of the actions runtime reachable by the worker,
+// render mode uses the configured values only and falls back to 127.0.0.1 without network lookups
+func (t *Task) runtimeHostname() (string, error) {
+	if hn := t.Runtime.Hostname; hn != "" {
+		return hn, nil
+	}
+	if preferredIp := t.Runtime.PreferredOutboundIP; preferredIp != "" && net.ParseIP(preferredIp) != nil {
+		return preferredIp, nil
+	}
+	if t.Render != nil {
+		return "127.0.0.1", nil
+	}
+	ip := common.GetOutboundIP()
+	if ip == nil {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	hostname := ip.String()
+	if t.Runtime.UseDNSName {
+		names, err := net.LookupAddr(hostname)
+		if err != nil {
+			return "", err
+		}
+		if len(names) >= 1 {
+			hostname = names[0]
+		}
+	}
+	return hostname, nil
+}
+
 func ToTemplateToken(node yaml.Node) *protocol.TemplateToken {
 	switch node.Kind {
 	case yaml.ScalarNode:
@@ -215,6 +266,13 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// every dispatched task is finished once, tasks failing before the final report count as failure
+	startedAt := time.Now()
+	result := runnerv1.Result_RESULT_FAILURE
+	defer func() {
+		t.metric.TaskFinished(result, time.Since(startedAt))
+	}()
+
 	_, exist := globalTaskMap.Load(task.Id)
 	if exist {
 		return fmt.Errorf("task %d already exists", task.Id)
@@ -231,10 +289,21 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 		}()
 	}()
 
+	t.updateStatus(func(status *TaskStatus) {
+		status.ID = task.Id
+		status.StartedAt = time.Now()
+	})
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+
 	// set task ve to global map
 	// when task is done or canceled, it will be removed from the map
 	globalTaskMap.Store(task.Id, t)
 	defer globalTaskMap.Delete(task.Id)
+	// runs after the final report
+	t.journal.Add(task.Id)
+	defer t.journal.Remove(task.Id)
 
 	workflow, err := model.ReadWorkflow(bytes.NewReader(task.WorkflowPayload))
 	if err != nil {
@@ -248,8 +317,23 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	}
 	jobID := jobIDs[0]
 	job := workflow.GetJob(jobID)
+	jobContainer := ToTemplateToken(job.RawContainer)
+	if jobContainer == nil && t.platformPicker != nil {
+		// the label scheme of the runner selects the default container
+		if image := t.platformPicker(job.RunsOn()); image != "" {
+			log.Infof("task %v runs in the default container %s of the runs-on labels %v", task.Id, image, job.RunsOn())
+			jobContainer = &protocol.TemplateToken{}
+			jobContainer.FromRawObject(map[interface{}]interface{}{
+				"image": image,
+			})
+		}
+	}
 
 	dataContext := task.Context.Fields
+	t.updateStatus(func(status *TaskStatus) {
+		status.Repository = dataContext["repository"].GetStringValue()
+		status.Job = jobID
+	})
 
 	log.Infof("task %v repo is %v %v %v", task.Id, dataContext["repository"].GetStringValue(),
 		dataContext["gitea_default_actions_url"].GetStringValue(),
@@ -344,15 +428,18 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 		shouldskip = true
 	}
 	actionsHttpServerHandler := &server.ActionsServer{
-		TraceLog:         make(chan interface{}),
 		ServerURL:        dataContext["server_url"].GetStringValue(),
 		ActionsServerURL: dataContext["gitea_default_actions_url"].GetStringValue(),
 		AuthData:         map[string]*protocol.ActionDownloadAuthentication{},
 		Token:            preset.Token,
 	}
-	defer func() {
-		close(actionsHttpServerHandler.TraceLog)
-	}()
+	// render mode neither receives nor reports messages of a worker
+	if t.Render == nil {
+		actionsHttpServerHandler.TraceLog = make(chan interface{})
+		defer func() {
+			close(actionsHttpServerHandler.TraceLog)
+		}()
+	}
 	steps := []protocol.ActionStep{}
 	type StepMeta struct {
 		LogIndex  int64
@@ -363,6 +450,12 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	stepMeta := make(map[string]*StepMeta)
 	var stepIndex int64 = -1
 	taskState := &runnerv1.TaskState{Id: task.GetId(), Steps: make([]*runnerv1.StepState, len(job.Steps)), StartedAt: timestamppb.Now()}
+	if shouldskip && t.Render != nil {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w by if: %s", ErrJobSkipped, job.If.Value)
+	}
 	if shouldskip {
 		taskState.Steps = []*runnerv1.StepState{}
 		taskState.StoppedAt = taskState.StartedAt
@@ -370,6 +463,7 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 		if err != nil {
 			taskState.Result = runnerv1.Result_RESULT_FAILURE
 		}
+		result = taskState.Result
 		return updateTask(reportingCtx, t, taskState, cancel, nil)
 	}
 	outputs := map[string]string{}
@@ -382,14 +476,20 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	var sentLogline int64 = 0
 	rows := []*runnerv1.LogRow{}
 	taskStateChanged := false
+	// bufferedRows is the amount of log rows reported to the metric
+	var bufferedRows atomic.Int64
+	reportBufferedRows := func(n int) {
+		t.metric.AddBufferedLogRows(int64(n) - bufferedRows.Swap(int64(n)))
+	}
 
 	var worker *exec.Cmd
 
-	go func() {
+	reportTraceLog := func() {
 		for {
 			var obj interface{}
 			var ok bool
 			nextMsg := false
+			reportBufferedRows(len(rows))
 
 			nextLogSync := time.Hour
 			if len(rows) > 0 && rows[0].Time != nil {
@@ -409,16 +509,19 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 				if err == nil {
 					diff := res.Msg.GetAckIndex() - sentLogline
 					sentLogline = res.Msg.GetAckIndex()
+					t.journal.SetLogIndex(task.Id, sentLogline)
 					if diff >= int64(len(rows)) {
 						rows = []*runnerv1.LogRow{}
 					} else if diff > 0 {
 						rows = rows[diff:]
 					}
 				} else if isUnauthenticatedError(err) {
+					t.metric.UpdateLogFailed()
 					log.Errorf("failed to update log: %v, has been removed", err)
 					rows = []*runnerv1.LogRow{}
 					cancel()
 				} else {
+					t.metric.UpdateLogFailed()
 					log.Errorf("failed to update log: %v, batching later", err)
 				}
 				nextMsg = true
@@ -435,7 +538,7 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 				break
 			}
 
-			if v, ok := os.LookupEnv("GITEA_RUNNER_TRACE"); ok && v == "1" {
+			if t.Log.Messages {
 				j, _ := json.MarshalIndent(obj, "", "    ")
 				fmt.Printf("MESSAGE: %s\n", j)
 			}
@@ -472,6 +575,12 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 
 				if step.StepIndex != -1 {
 					stepIndex = step.StepIndex
+					if stepIndex < int64(len(job.Steps)) {
+						name := job.Steps[stepIndex].String()
+						t.updateStatus(func(status *TaskStatus) {
+							status.Step = name
+						})
+					}
 					taskState.Steps[stepIndex].LogIndex = step.LogIndex
 					taskState.Steps[stepIndex].LogLength = step.LogLength
 				}
@@ -505,6 +614,8 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 								step.Result = runnerv1.Result_RESULT_SUCCESS
 							case "skipped":
 								step.Result = runnerv1.Result_RESULT_SKIPPED
+							case "canceled", "cancelled":
+								step.Result = runnerv1.Result_RESULT_CANCELLED
 							default:
 								step.Result = runnerv1.Result_RESULT_FAILURE
 							}
@@ -530,6 +641,8 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 						taskState.Result = runnerv1.Result_RESULT_SUCCESS
 					case "skipped":
 						taskState.Result = runnerv1.Result_RESULT_SKIPPED
+					case "canceled", "cancelled":
+						taskState.Result = runnerv1.Result_RESULT_CANCELLED
 					default:
 						taskState.Result = runnerv1.Result_RESULT_FAILURE
 					}
@@ -555,12 +668,21 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 				}
 			}
 		}
-	}()
+	}
+	if t.Render == nil {
+		go reportTraceLog()
+	}
 
-	actionsRuntimeListeningAddr := getListeningAddress("GITEA_ACTIONS_RUNNER_RUNTIME_LISTENING_ADDRESS")
-	listener, err := net.Listen("tcp", actionsRuntimeListeningAddr)
-	if err != nil {
-		return err
+	actionsRuntimeListeningAddr := t.Runtime.ListeningAddress
+	if actionsRuntimeListeningAddr == "" {
+		actionsRuntimeListeningAddr = ":0"
+	}
+	var listener net.Listener
+	if t.Render == nil {
+		listener, err = net.Listen("tcp", actionsRuntimeListeningAddr)
+		if err != nil {
+			return err
+		}
 	}
 
 	workerOptions := map[string]string{}
@@ -574,9 +696,10 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 			break
 		}
 	}
-	runnerWorker = runnerWorker[opts:]
+	// the last arg is replaced by the clone, the slice of the caller is shared with other tasks
+	runnerWorker = slices.Clone(runnerWorker[opts:])
 
-	if allowClone, ok := workerOptions["--allow-clone"]; ok && allowClone == "" {
+	if allowClone, ok := workerOptions["--allow-clone"]; ok && allowClone == "" && t.Render == nil {
 		if maxParallelRaw, ok := workerOptions["--max-parallel"]; ok {
 			maxParallel, _ := strconv.Atoi(maxParallelRaw)
 			if maxParallel > 1 {
@@ -589,6 +712,7 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 						return err
 					}
 					defer os.RemoveAll(tmpdir)
+					t.journal.SetCloneDir(task.Id, tmpdir)
 					runnerWorker[len(runnerWorker)-1] = path.Join(tmpdir, "bin", prefix+".Worker"+ext)
 				}
 			}
@@ -602,6 +726,9 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	}
 
 	defer func() {
+		if t.Render != nil {
+			return
+		}
 		if actionsHttpServer != nil {
 			actionsHttpServer.Shutdown(context.Background())
 		}
@@ -634,44 +761,31 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 					return fmt.Errorf("still logs missing")
 				}
 			} else if isUnauthenticatedError(err) {
+				t.metric.UpdateLogFailed()
 				log.Errorf("final failed to update log: %v, has been removed", err)
 				return nil
 			} else {
+				t.metric.UpdateLogFailed()
 				log.Errorf("final failed to update log: %v, batching later", err)
 			}
 			return err
 		}, retry.Context(reportingCtx))
+		reportBufferedRows(0)
 
 		if taskState.Result == runnerv1.Result_RESULT_UNSPECIFIED {
 			taskState.Result = runnerv1.Result_RESULT_FAILURE
 		}
 		taskState.StoppedAt = timestamppb.Now()
 		updateTask(reportingCtx, t, taskState, cancel, outputs)
+		result = taskState.Result
 		log.Info("Reporting done")
 	}()
 
-	var hostname string
-	if preferredIp := os.Getenv("GITEA_ACTIONS_RUNNER_RUNTIME_PREFERRED_OUTBOUND_IP"); preferredIp != "" && net.ParseIP(preferredIp) != nil {
-		hostname = preferredIp
-	} else {
-		ip := common.GetOutboundIP()
-		if ip == nil {
-			ip = net.IPv4(127, 0, 0, 1)
-		}
-		hostname = ip.String()
-	}
-	if hn := os.Getenv("GITEA_ACTIONS_RUNNER_RUNTIME_HOSTNAME"); hn != "" {
-		hostname = hn
-	} else if v := os.Getenv("GITEA_ACTIONS_RUNNER_RUNTIME_USE_DNS_NAME"); v == "1" || strings.EqualFold(v, "true") || strings.EqualFold(v, "yes") || strings.EqualFold(v, "y") {
-		names, err := net.LookupAddr(hostname)
-		if err != nil {
-			return err
-		}
-		if len(names) >= 1 {
-			hostname = names[0]
-		}
+	hostname, err := t.runtimeHostname()
+	if err != nil {
+		return err
 	}
-	if v := os.Getenv("GITEA_ACTIONS_RUNNER_RUNTIME_APPEND_NO_PROXY"); v == "1" || strings.EqualFold(v, "true") || strings.EqualFold(v, "yes") || strings.EqualFold(v, "y") {
+	if t.Runtime.AppendNoProxy && t.Render == nil {
 		no_proxy := os.Getenv("no_proxy")
 		if no_proxy == "" {
 			no_proxy = os.Getenv("NO_PROXY")
@@ -684,15 +798,19 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 		os.Setenv("NO_PROXY", no_proxy)
 	}
 
-	externalURL := os.Getenv("GITEA_ACTIONS_RUNNER_RUNTIME_EXTERNAL_URL")
+	externalURL := t.Runtime.ExternalURL
 	if externalURL == "" {
-		externalURL = fmt.Sprintf("http://%s:%d/", hostname, listener.Addr().(*net.TCPAddr).Port)
+		port := 0
+		if listener != nil {
+			port = listener.Addr().(*net.TCPAddr).Port
+		}
+		externalURL = fmt.Sprintf("http://%s:%d/", hostname, port)
 	}
 	// Normalize externalURL to ensure it ends with a slash
 	actionsHttpServerHandler.ExternalURL = strings.TrimSuffix(externalURL, "/") + "/"
 
-	cacheServerUrl := os.Getenv("GITEA_ACTIONS_CACHE_SERVER_URL")
-	if actionsHttpServer != nil && cacheServerUrl == "" {
+	cacheServerUrl := t.Cache.ServerURL
+	if actionsHttpServer != nil && cacheServerUrl == "" && t.Render == nil {
 		if wd, err := os.Getwd(); err == nil {
 			if actionsRuntimeListeningAddr == ":0" {
 				if cache, err := artifactcache.StartHandler(filepath.Join(wd, "cache"), hostname, 0, log.New()); err == nil {
@@ -709,7 +827,7 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	if cacheServerUrl != "" {
 		cacheServerUrl = strings.TrimSuffix(cacheServerUrl, "/") + "/"
 	}
-	if actionsHttpServer != nil {
+	if actionsHttpServer != nil && listener != nil {
 		go func() {
 			actionsHttpServer.Serve(listener)
 		}()
@@ -885,7 +1003,6 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	jobServiceContainers := yaml.Node{}
 	jobServiceContainers.Encode(job.Services)
 
-	envs := []protocol.TemplateToken{}
 	defs := []protocol.TemplateToken{}
 	def := yaml.Node{}
 
@@ -902,14 +1019,7 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 		}
 	}
 
-	def.Encode(workflow.Env)
-	if d := ToTemplateToken(def); d != nil && !def.IsZero() {
-		envs = append(envs, *d)
-	}
-
-	if d := ToTemplateToken(job.Env); d != nil && !job.Env.IsZero() {
-		envs = append(envs, *d)
-	}
+	envs := jobEnvironments(jobEnviron(t.Input.envs, t.Input.labelEnvs, job.RunsOn()), workflow.Env, job.Env)
 
 	matrix := map[string]interface{}{}
 	matrixes, _ := job.GetMatrixes()
@@ -1008,7 +1118,7 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 			"needs":    server.ToPipelineContextData(needsctx),
 			"vars":     server.ToPipelineContextData(convertToRawMap(task.GetVars())),
 		},
-		JobContainer:         ToTemplateToken(job.RawContainer),
+		JobContainer:         jobContainer,
 		JobServiceContainers: ToTemplateToken(jobServiceContainers),
 		Defaults:             defs,
 		EnvironmentVariables: envs,
@@ -1031,6 +1141,9 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	for k, v := range task.Secrets {
 		jmessage.Variables[k] = protocol.VariableValue{Value: v, IsSecret: true}
 	}
+	if t.Render != nil {
+		return t.Render(jmessage)
+	}
 
 	actionsHttpServerHandler.JobRequest = jmessage
 	actionsHttpServerHandler.CancelCtx = ctx
@@ -1113,6 +1226,8 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 		}))
 		if err == nil {
 			logline = res.Msg.GetAckIndex()
+		} else {
+			t.metric.UpdateLogFailed()
 		}
 		return fmt.Errorf("failed to execute worker exitcode: %v", exitcode)
 	}
@@ -1120,14 +1235,6 @@ func (t *Task) Run(ctx context.Context, task *runnerv1.Task, runnerWorker []stri
 	return nil
 }
 
-func getListeningAddress(envName string) string {
-	addr := os.Getenv(envName)
-	if addr == "" {
-		addr = ":0"
-	}
-	return addr
-}
-
 // Check Timeline Integrity adding fake started and stopped boundaries
 func checkIntegrity(taskState *runnerv1.TaskState) {
 	stepsWithPrePost := []*runnerv1.StepState{
@@ -1172,10 +1279,7 @@ func checkIntegrity(taskState *runnerv1.TaskState) {
 }
 
 func isUnauthenticatedError(err error) bool {
-	if err == nil {
-		return false
-	}
-	return strings.Contains(err.Error(), "Unauthenticated")
+	return err != nil && connect.CodeOf(err) == connect.CodeUnauthenticated
 }
 
 func updateTaskNoRetry(ctx context.Context, t *Task, taskState *runnerv1.TaskState, cancel context.CancelFunc, outputs map[string]string) error {
@@ -1184,12 +1288,18 @@ func updateTaskNoRetry(ctx context.Context, t *Task, taskState *runnerv1.TaskSta
 		Outputs: outputs,
 	}))
 
+	if err != nil {
+		t.metric.UpdateTaskFailed()
+	}
 	if isUnauthenticatedError(err) {
 		log.Errorf("failed to update task: %v, has been removed", err)
 		cancel()
 		return nil
 	}
 
+	if err == nil {
+		t.journal.SetState(taskState)
+	}
 	if err == nil && resp.Msg.State != nil && resp.Msg.State.Result != runnerv1.Result_RESULT_UNSPECIFIED {
 		cancel()
 	}
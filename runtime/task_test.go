@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	runnerv1 "code.gitea.io/actions-proto-go/runner/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// recordMetric records the results of finished tasks
+type recordMetric struct {
+	noopMetric
+	mu       sync.Mutex
+	finished []runnerv1.Result
+}
+
+func (m *recordMetric) TaskFinished(result runnerv1.Result, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.finished = append(m.finished, result)
+}
+
+func TestRunFinishedOnce(t *testing.T) {
+	taskContext, err := structpb.NewStruct(map[string]any{"repository": "owner/repo"})
+	assert.NoError(t, err)
+	for _, tc := range []struct {
+		name     string
+		payload  string
+		expected runnerv1.Result
+	}{
+		{
+			name:     "invalid workflow",
+			payload:  "jobs: [",
+			expected: runnerv1.Result_RESULT_FAILURE,
+		},
+		{
+			name:     "multiple jobs",
+			payload:  "on: push\njobs:\n  a:\n    runs-on: ubuntu\n    steps:\n    - run: echo\n  b:\n    runs-on: ubuntu\n    steps:\n    - run: echo\n",
+			expected: runnerv1.Result_RESULT_FAILURE,
+		},
+		{
+			name:     "skipped",
+			payload:  "on: push\njobs:\n  a:\n    if: false\n    runs-on: ubuntu\n    steps:\n    - run: echo\n",
+			expected: runnerv1.Result_RESULT_SKIPPED,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			metric := &recordMetric{}
+			task := NewTask("https://gitea.example", 1, &journalClient{}, nil, nil)
+			task.metric = metric
+			_ = task.Run(context.Background(), &runnerv1.Task{Id: 1, WorkflowPayload: []byte(tc.payload), Context: taskContext}, nil)
+			assert.Equal(t, []runnerv1.Result{tc.expected}, metric.finished)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package selfupdate
+
+import (
+	"os"
+	"syscall"
+)
+
+// Restart replaces the running process with the updated exe using the same arguments
+func Restart(exe string) error {
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
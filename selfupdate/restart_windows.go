@@ -0,0 +1,6 @@
+package selfupdate
+
+// Restart is not possible in place on windows, the service manager restarts the runner
+func Restart(exe string) error {
+	return ErrRestartRequired
+}
@@ -0,0 +1,202 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/ChristopherHX/gitea-actions-runner/util"
+)
+
+// backupSuffix is appended to the executable to keep the previous binary for Rollback
+const backupSuffix = ".old"
+
+// ErrRestartRequired is returned by Restart if the process cannot be replaced in place like on windows
+var ErrRestartRequired = errors.New("restart the runner to use the updated binary")
+
+var (
+	apiURL      = "https://api.github.com"
+	downloadURL = "https://github.com"
+)
+
+// Latest returns the tag of the latest release of repo
+func Latest(ctx context.Context, repo string) (string, error) {
+	body, err := get(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", apiURL, repo))
+	if err != nil {
+		return "", err
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return "", err
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("latest release of %s has no tag", repo)
+	}
+	return release.TagName, nil
+}
+
+// AssetName returns the name of the release binary for the platform
+func AssetName(tag, goos, goarch string) string {
+	name := fmt.Sprintf("gitea-actions-runner-%s-%s-%s", strings.TrimPrefix(tag, "v"), goos, goarch)
+	if goarch == "arm" {
+		name += "-7"
+	}
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Newer reports whether the release tag is newer than the current version,
+// versions which are not a release like local builds are never updated automatically
+func Newer(tag, current string) bool {
+	a, ok := parseVersion(tag)
+	if !ok {
+		return false
+	}
+	b, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return false
+}
+
+// parseVersion parses v1.2.3, the suffix of git describe like -3-gabcdef is ignored
+func parseVersion(version string) ([3]int, bool) {
+	var v [3]int
+	version, _, _ = strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// Update replaces exe with the binary of the release tag for the current platform,
+// the checksum is verified against checksums.txt of the release and the previous binary is kept for Rollback
+func Update(ctx context.Context, logger util.Logger, repo, tag, exe string) error {
+	asset := AssetName(tag, runtime.GOOS, runtime.GOARCH)
+	base := fmt.Sprintf("%s/%s/releases/download/%s", downloadURL, repo, tag)
+	checksums, err := get(ctx, base+"/checksums.txt")
+	if err != nil {
+		return err
+	}
+	expected, err := util.FindChecksum(checksums, asset)
+	if err != nil {
+		return err
+	}
+	if logger != nil {
+		logger.Infof("Downloading %s/%s", base, asset)
+	}
+	binary, err := get(ctx, base+"/"+asset)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(binary)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("checksum of %s is %s, expected %s", asset, actual, expected)
+	}
+	return replace(exe, binary)
+}
+
+// replace writes the new binary next to exe and swaps them by renames,
+// so exe is never partially written
+func replace(exe string, binary []byte) error {
+	st, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	next := exe + ".new"
+	if err := os.WriteFile(next, binary, st.Mode().Perm()|0o700); err != nil {
+		os.Remove(next)
+		return err
+	}
+	backup := exe + backupSuffix
+	os.Remove(backup)
+	// windows allows to rename, but not to replace the running executable
+	if err := os.Rename(exe, backup); err != nil {
+		os.Remove(next)
+		return err
+	}
+	if err := os.Rename(next, exe); err != nil {
+		if rerr := os.Rename(backup, exe); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		os.Remove(next)
+		return err
+	}
+	return nil
+}
+
+// Rollback restores the binary replaced by the last Update, the updated binary becomes the backup
+func Rollback(exe string) error {
+	backup := exe + backupSuffix
+	if _, err := os.Stat(backup); err != nil {
+		return fmt.Errorf("no previous binary to restore: %w", err)
+	}
+	current := exe + ".rollback"
+	if err := os.Rename(exe, current); err != nil {
+		return err
+	}
+	if err := os.Rename(backup, exe); err != nil {
+		if rerr := os.Rename(current, exe); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	return os.Rename(current, backup)
+}
+
+// Executable returns the path of the running binary with resolved symlinks
+func Executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("User-Agent", "gitea-actions-runner")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, rsp.Status)
+	}
+	return body, nil
+}
@@ -0,0 +1,80 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssetName(t *testing.T) {
+	assert.Equal(t, "gitea-actions-runner-0.1.0-linux-amd64", AssetName("v0.1.0", "linux", "amd64"))
+	assert.Equal(t, "gitea-actions-runner-0.1.0-linux-arm-7", AssetName("v0.1.0", "linux", "arm"))
+	assert.Equal(t, "gitea-actions-runner-0.1.0-windows-amd64.exe", AssetName("v0.1.0", "windows", "amd64"))
+}
+
+func TestNewer(t *testing.T) {
+	assert.True(t, Newer("v0.2.0", "v0.1.9"))
+	assert.True(t, Newer("v0.1.10", "v0.1.9-3-gabcdef"))
+	assert.False(t, Newer("v0.1.0", "v0.1.0"))
+	assert.False(t, Newer("v0.1.0", "v0.2.0"))
+	assert.False(t, Newer("v0.2.0", "local"))
+}
+
+func TestUpdateAndRollback(t *testing.T) {
+	binary := []byte("new binary")
+	sum := sha256.Sum256(binary)
+	asset := AssetName("v0.2.0", runtime.GOOS, runtime.GOARCH)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/runner/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name":"v0.2.0"}`)
+	})
+	mux.HandleFunc("/owner/runner/releases/download/v0.2.0/checksums.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  %s\n%s  other\n", hex.EncodeToString(sum[:]), asset, hex.EncodeToString(sum[:]))
+	})
+	mux.HandleFunc("/owner/runner/releases/download/v0.2.0/"+asset, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(binary)
+	})
+	mux.HandleFunc("/owner/runner/releases/download/v0.3.0/checksums.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%064d  %s\n", 0, AssetName("v0.3.0", runtime.GOOS, runtime.GOARCH))
+	})
+	mux.HandleFunc("/owner/runner/releases/download/v0.3.0/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tampered"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	apiURL, downloadURL = server.URL, server.URL
+	defer func() {
+		apiURL, downloadURL = "https://api.github.com", "https://github.com"
+	}()
+
+	ctx := context.Background()
+	tag, err := Latest(ctx, "owner/runner")
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.2.0", tag)
+
+	exe := filepath.Join(t.TempDir(), "gitea-actions-runner")
+	assert.NoError(t, os.WriteFile(exe, []byte("old binary"), 0o755))
+	assert.NoError(t, Update(ctx, nil, "owner/runner", tag, exe))
+	content, _ := os.ReadFile(exe)
+	assert.Equal(t, "new binary", string(content))
+
+	// a checksum mismatch keeps the current binary
+	assert.ErrorContains(t, Update(ctx, nil, "owner/runner", "v0.3.0", exe), "checksum")
+	content, _ = os.ReadFile(exe)
+	assert.Equal(t, "new binary", string(content))
+
+	assert.NoError(t, Rollback(exe))
+	content, _ = os.ReadFile(exe)
+	assert.Equal(t, "old binary", string(content))
+	content, _ = os.ReadFile(exe + backupSuffix)
+	assert.Equal(t, "new binary", string(content))
+}
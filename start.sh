@@ -21,9 +21,12 @@ if [[ -z "${GITEA_RUNNER_REGISTRATION_TOKEN}" ]] && [[ -f "${GITEA_RUNNER_REGIST
   GITEA_RUNNER_REGISTRATION_TOKEN=$(cat "${GITEA_RUNNER_REGISTRATION_TOKEN_FILE}")
 fi
 
-if [[ ! -z "${GITEA_RUNNER_PAT}" ]]; then
-  GITEA_RUNNER_REGISTRATION_TOKEN="$(curl -s -L -X POST -H "Accept: application/vnd.github+json" -H "Authorization: Bearer ${GITEA_RUNNER_PAT}" ${GITEA_INSTANCE_URL}/api/v1/repos/${GITEA_RUNNER_OWNER}/${GITEA_RUNNER_REPO}/actions/runners/registration-token | jq .token -r)"
-  unset GITEA_RUNNER_PAT
+# GITEA_RUNNER_PAT is read by the register command to fetch the registration token
+if [[ ! -z "${GITEA_RUNNER_OWNER}" ]]; then
+  EXTRA_ARGS="${EXTRA_ARGS} --owner ${GITEA_RUNNER_OWNER}"
+fi
+if [[ ! -z "${GITEA_RUNNER_REPO}" ]]; then
+  EXTRA_ARGS="${EXTRA_ARGS} --repo ${GITEA_RUNNER_REPO}"
 fi
 
 # Use the same ENV variable names as https://github.com/vegardit/docker-gitea-act-runner
@@ -33,44 +36,49 @@ if [[ ! -s "$RUNNER_STATE_FILE" ]]; then
   try=1
   success=0
 
-  # The point of this loop is to make it simple, when running both act_runner and gitea in docker,
-  # for the act_runner to wait a moment for gitea to become available before erroring out.  Within
-  # the context of a single docker-compose, something similar could be done via healthchecks, but
-  # this is more flexible.
+  # The register command waits up to GITEA_REG_WAIT_TIMEOUT for gitea to become available,
+  # when running both act_runner and gitea in docker. Failed registrations are retried GITEA_MAX_REG_ATTEMPTS times.
   while [[ $success -eq 0 ]] && [[ $try -lt ${GITEA_MAX_REG_ATTEMPTS:-10} ]]; do
-    /runner/gitea-actions-runner register \
+    if /runner/gitea-actions-runner register \
       --instance "${GITEA_INSTANCE_URL}" \
       --token    "${GITEA_RUNNER_REGISTRATION_TOKEN}" \
       --name     "${GITEA_RUNNER_NAME:-`hostname`}" \
       --worker python3,/runner/actions-runner-worker.py,/home/runner/bin/Runner.Worker \
-      ${EXTRA_ARGS} --no-interactive 2>&1 | tee /tmp/reg.log
-
-    cat /tmp/reg.log | grep 'Runner registered successfully' > /dev/null
-    if [[ $? -eq 0 ]]; then
+      --wait-timeout "${GITEA_REG_WAIT_TIMEOUT:-1m}" \
+      ${EXTRA_ARGS} --no-interactive; then
       echo "SUCCESS"
       success=1
-
-      jq --null-input \
-         --arg agentName "${GITEA_RUNNER_NAME:-`hostname`}" \
-         --arg workFolder "/home/runner/_work" \
-        '{ "isHostedServer": false, "agentName": $agentName, "workFolder": $workFolder }' > /data/.actions_runner
     else
       echo "Waiting to retry ..."
       try=$(($try + 1))
       sleep 5
     fi
   done
+  if [[ $success -eq 0 ]]; then
+    exit 1
+  fi
 fi
 
+if [[ "${GITEA_RUNNER_UNAUTHENTICATED_POLICY}" != "reregister" ]]; then
+  unset GITEA_RUNNER_PAT
+fi
+
+# Escape backslashes and double quotes of a JSON string
+json_escape() {
+  local value="${1//\\/\\\\}"
+  printf '%s' "${value//\"/\\\"}"
+}
+
 if [[ ! -s "/data/.actions_runner" ]]; then
-  jq --null-input \
-         --arg agentName "${GITEA_RUNNER_NAME:-`hostname`}" \
-         --arg workFolder "/home/runner/_work" \
-        '{ "isHostedServer": false, "agentName": $agentName, "workFolder": $workFolder }' > /data/.actions_runner
+  printf '{ "isHostedServer": false, "agentName": "%s", "workFolder": "%s" }\n' \
+    "$(json_escape "${GITEA_RUNNER_NAME:-`hostname`}")" \
+    "$(json_escape "/home/runner/_work")" > /data/.actions_runner
 fi
 
-# Prevent reading the token from the act_runner process
-unset GITEA_RUNNER_REGISTRATION_TOKEN
-unset GITEA_RUNNER_REGISTRATION_TOKEN_FILE
+# Prevent reading the token from the act_runner process, unless it is needed to register again
+if [[ "${GITEA_RUNNER_UNAUTHENTICATED_POLICY}" != "reregister" ]]; then
+  unset GITEA_RUNNER_REGISTRATION_TOKEN
+  unset GITEA_RUNNER_REGISTRATION_TOKEN_FILE
+fi
 
 /runner/gitea-actions-runner daemon "$@" ${GITEA_RUNNER_ONCE+"--once"}
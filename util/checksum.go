@@ -0,0 +1,143 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+//go:generate go run gen_checksums.go
+
+// pinnedChecksums is the manifest of sha256 checksums shipped with the binary
+//
+//go:embed checksums.txt
+var pinnedChecksums []byte
+
+var githubAPIURL = "https://api.github.com"
+
+var sha256Pattern = regexp.MustCompile(`\b[0-9a-fA-F]{64}\b`)
+
+// FindChecksum returns the sha256 of name in the format of sha256sum, lines starting with # are ignored
+func FindChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name && sha256Pattern.MatchString(fields[0]) {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum found for %s", name)
+}
+
+// ExpectedChecksum returns the sha256 of a release asset from the pinned manifest,
+// otherwise from the checksums published by the github release
+func ExpectedChecksum(ctx context.Context, repo, tag, asset string) (string, error) {
+	if sum, err := FindChecksum(pinnedChecksums, asset); err == nil {
+		return sum, nil
+	}
+	return publishedChecksum(ctx, repo, tag, asset)
+}
+
+// mirrorChecksum returns the sha256 of the asset from the pinned manifest, otherwise from <url>.sha256 of the mirror
+func mirrorChecksum(ctx context.Context, url, asset string) (string, error) {
+	if sum, err := FindChecksum(pinnedChecksums, asset); err == nil {
+		return sum, nil
+	}
+	content, err := httpGet(ctx, url+".sha256")
+	if err != nil {
+		return "", fmt.Errorf("no sha256 checksum of %s: %w", asset, err)
+	}
+	sum := sha256Pattern.Find(content)
+	if sum == nil {
+		return "", fmt.Errorf("no sha256 checksum of %s in %s.sha256", asset, url)
+	}
+	return strings.ToLower(string(sum)), nil
+}
+
+// publishedChecksum looks up the digest of the asset, the hashes of the release notes used by actions/runner
+// and the checksum files of the release like hashes.sha256 of PowerShell
+func publishedChecksum(ctx context.Context, repo, tag, asset string) (string, error) {
+	content, err := httpGet(ctx, fmt.Sprintf("%s/repos/%s/releases/tags/%s", githubAPIURL, repo, tag))
+	if err != nil {
+		return "", err
+	}
+	var release struct {
+		Body   string `json:"body"`
+		Assets []struct {
+			Name   string `json:"name"`
+			Digest string `json:"digest"`
+			URL    string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(content, &release); err != nil {
+		return "", err
+	}
+	for _, a := range release.Assets {
+		if digest, ok := strings.CutPrefix(a.Digest, "sha256:"); ok && a.Name == asset {
+			return strings.ToLower(digest), nil
+		}
+	}
+	for _, line := range strings.Split(release.Body, "\n") {
+		if strings.Contains(line, asset) {
+			if sum := sha256Pattern.FindString(line); sum != "" {
+				return strings.ToLower(sum), nil
+			}
+		}
+	}
+	for _, a := range release.Assets {
+		switch a.Name {
+		case asset + ".sha256":
+			content, err := httpGet(ctx, a.URL)
+			if err != nil {
+				return "", err
+			}
+			if sum := sha256Pattern.Find(content); sum != nil {
+				return strings.ToLower(string(sum)), nil
+			}
+		case "checksums.txt", "hashes.sha256", "SHA256SUMS":
+			content, err := httpGet(ctx, a.URL)
+			if err != nil {
+				return "", err
+			}
+			if sum, err := FindChecksum(content, asset); err == nil {
+				return sum, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no sha256 checksum of %s published by %s %s", asset, repo, tag)
+}
+
+func httpGet(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("User-Agent", "github-act-runner/1.0.0")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	content, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, rsp.Status)
+	}
+	return content, nil
+}
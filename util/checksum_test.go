@@ -0,0 +1,63 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectedChecksum(t *testing.T) {
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/tool/releases/tags/v1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"body": "- tool-linux-x64.tar.gz <!-- BEGIN SHA linux-x64 -->" + sum("notes") + "<!-- END SHA linux-x64 -->",
+			"assets": []map[string]any{
+				{"name": "tool-win-x64.zip", "digest": "sha256:" + sum("digest")},
+				{"name": "hashes.sha256", "browser_download_url": server.URL + "/hashes.sha256"},
+			},
+		})
+	})
+	mux.HandleFunc("/hashes.sha256", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(sum("file") + " *tool-osx-x64.tar.gz\n"))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+	githubAPIURL = server.URL
+	defer func() {
+		githubAPIURL = "https://api.github.com"
+	}()
+
+	ctx := context.Background()
+	checksum, err := ExpectedChecksum(ctx, "owner/tool", "v1.0.0", "tool-win-x64.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, sum("digest"), checksum)
+	checksum, err = ExpectedChecksum(ctx, "owner/tool", "v1.0.0", "tool-linux-x64.tar.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, sum("notes"), checksum)
+	checksum, err = ExpectedChecksum(ctx, "owner/tool", "v1.0.0", "tool-osx-x64.tar.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, sum("file"), checksum)
+	_, err = ExpectedChecksum(ctx, "owner/tool", "v1.0.0", "tool-linux-arm.tar.gz")
+	assert.ErrorContains(t, err, "no sha256 checksum")
+}
+
+func TestPinnedChecksums(t *testing.T) {
+	var missing []string
+	for _, asset := range DefaultAssets() {
+		if _, err := FindChecksum(pinnedChecksums, asset.Name); err != nil {
+			missing = append(missing, asset.Name)
+		}
+	}
+	assert.Empty(t, missing, "checksums.txt misses default assets, run go generate ./util")
+}
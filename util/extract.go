@@ -7,6 +7,7 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -14,10 +15,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/nektos/act/pkg/filecollector"
+	log "github.com/sirupsen/logrus"
 )
 
 type Logger interface {
@@ -74,7 +77,14 @@ func ExtractTarGz(reader io.Reader, dir string) error {
 	return ExtractTar(gzr, dir)
 }
 
-func DownloadTool(ctx context.Context, logger Logger, url, dest string) error {
+// DownloadTool downloads the archive of url and extracts it to dest if its sha256 matches checksum,
+// dest is removed if the download or the extraction fails
+func DownloadTool(ctx context.Context, logger Logger, url, dest, checksum string) (err error) {
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dest)
+		}
+	}()
 	token := ""
 	httpClient := http.DefaultClient
 	randBytes := make([]byte, 16)
@@ -117,13 +127,20 @@ func DownloadTool(ctx context.Context, logger Logger, url, dest string) error {
 			case <-ch:
 				return
 			case <-time.After(time.Second * 10):
+				if logger == nil {
+					continue
+				}
 				off, _ := fo.Seek(0, 1)
-				percent := off * 100 / rsp.ContentLength
-				logger.Infof("Downloading... %d%%\n", percent)
+				if rsp.ContentLength > 0 {
+					logger.Infof("Downloading... %d%%\n", off*100/rsp.ContentLength)
+				} else {
+					logger.Infof("Downloading... %d bytes\n", off)
+				}
 			}
 		}
 	}()
-	l, err := io.Copy(fo, rsp.Body)
+	hash := sha256.New()
+	l, err := io.Copy(io.MultiWriter(fo, hash), rsp.Body)
 	close(ch)
 	if err != nil {
 		return err
@@ -131,6 +148,9 @@ func DownloadTool(ctx context.Context, logger Logger, url, dest string) error {
 	if rsp.ContentLength >= 0 && l != rsp.ContentLength {
 		return fmt.Errorf("failed to download tar expected %v, but copied %v", rsp.ContentLength, l)
 	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(actual, checksum) {
+		return fmt.Errorf("sha256 of %s is %s, expected %s", url, actual, checksum)
+	}
 	tarstream = fo
 	_, _ = fo.Seek(0, 0)
 	if strings.HasSuffix(url, ".tar.gz") {
@@ -146,67 +166,192 @@ func DownloadTool(ctx context.Context, logger Logger, url, dest string) error {
 	return nil
 }
 
+// DefaultDownloadURL is the url template of the runner and pwsh release assets,
+// {repo}, {tag} and {asset} are replaced with the github repository, the release tag and the file name
+const DefaultDownloadURL = "https://github.com/{repo}/releases/download/{tag}/{asset}"
+
+// URL returns the download url of the asset for a template like DefaultDownloadURL
+func (a Asset) URL(urlTemplate string) string {
+	return strings.NewReplacer("{repo}", a.Repo, "{tag}", a.Tag, "{asset}", a.Name).Replace(urlTemplate)
+}
+
+// downloadRelease downloads the asset of a github release or its mirror after looking up its sha256
+func downloadRelease(ctx context.Context, logger Logger, urlTemplate string, asset Asset, dest string) error {
+	if urlTemplate == "" {
+		urlTemplate = DefaultDownloadURL
+	}
+	url := asset.URL(urlTemplate)
+	var checksum string
+	var err error
+	if urlTemplate == DefaultDownloadURL {
+		checksum, err = ExpectedChecksum(ctx, asset.Repo, asset.Tag, asset.Name)
+	} else {
+		checksum, err = mirrorChecksum(ctx, url, asset.Name)
+	}
+	if err != nil {
+		return err
+	}
+	return DownloadTool(ctx, logger, url, dest, checksum)
+}
+
+// archiveChecksum returns the sha256 of a local archive from the pinned manifest or from <file>.sha256 next to it,
+// an empty checksum if neither exists
+func archiveChecksum(file string) (string, error) {
+	if sum, err := FindChecksum(pinnedChecksums, filepath.Base(file)); err == nil {
+		return sum, nil
+	}
+	content, err := os.ReadFile(file + ".sha256")
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	sum := sha256Pattern.Find(content)
+	if sum == nil {
+		return "", fmt.Errorf("no sha256 checksum in %s.sha256", file)
+	}
+	return strings.ToLower(string(sum)), nil
+}
+
+// ExtractArchive extracts a local .tar.gz or .zip file to dest, its sha256 is verified with the pinned manifest
+// or <file>.sha256. Archives without checksum are rejected unless skipVerify is set, dest is removed if the extraction fails
+func ExtractArchive(logger Logger, file, dest string, skipVerify bool) (err error) {
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dest)
+		}
+	}()
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	expected, err := archiveChecksum(file)
+	if err != nil {
+		return err
+	}
+	if expected == "" {
+		if !skipVerify {
+			return fmt.Errorf("cannot verify %s, no sha256 checksum is pinned and %s.sha256 does not exist", file, file)
+		}
+		log.Warnf("%s is not verified, no sha256 checksum is pinned and %s.sha256 does not exist", file, file)
+	} else {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return err
+		}
+		if actual := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(actual, expected) {
+			return fmt.Errorf("sha256 of %s is %s, expected %s", file, actual, expected)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if logger != nil {
+		logger.Infof("Extracting %s to %s", file, dest)
+	}
+	switch {
+	case strings.HasSuffix(file, ".tar.gz"), strings.HasSuffix(file, ".tgz"):
+		return ExtractTarGz(f, dest)
+	case strings.HasSuffix(file, ".zip"):
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return ExtractZip(f, st.Size(), dest)
+	}
+	return fmt.Errorf("unsupported archive %s, expected .tar.gz or .zip", file)
+}
+
+// releaseArchs maps GOOS/GOARCH to the architecture and archive extension of the runner and pwsh release assets
+var releaseArchs = map[string][2]string{
+	"windows/386":   {"win-x86", "zip"},
+	"windows/amd64": {"win-x64", "zip"},
+	"windows/arm64": {"win-arm64", "zip"},
+	"linux/amd64":   {"linux-x64", "tar.gz"},
+	"linux/arm":     {"linux-arm", "tar.gz"},
+	"linux/arm64":   {"linux-arm64", "tar.gz"},
+	"darwin/amd64":  {"osx-x64", "tar.gz"},
+	"darwin/arm64":  {"osx-arm64", "tar.gz"},
+}
+
+// Asset is a file of a github release downloaded by the setup
+type Asset struct {
+	Repo string
+	Tag  string
+	Name string
+}
+
+func releaseAsset(repo, tag, format, plat string) (Asset, error) {
+	arch, ok := releaseArchs[plat]
+	if !ok {
+		return Asset{}, fmt.Errorf("unsupported platform %s", plat)
+	}
+	return Asset{Repo: repo, Tag: tag, Name: fmt.Sprintf(format, arch[0], arch[1])}, nil
+}
+
+// RunnerAsset returns the archive of the official runner for plat
+func RunnerAsset(plat, version string) (Asset, error) {
+	return releaseAsset("actions/runner", "v"+version, "actions-runner-%s-"+version+".%s", plat)
+}
+
+// RunnerServerAsset returns the archive of runner.server for plat
+func RunnerServerAsset(plat, version string) (Asset, error) {
+	return releaseAsset("ChristopherHX/runner.server", "v"+version, "runner.server-%s.%s", plat)
+}
+
+// PwshAsset returns the archive of pwsh for plat
+func PwshAsset(plat, version string) (Asset, error) {
+	return releaseAsset("PowerShell/PowerShell", "v"+version, "powershell-"+version+"-%s.%s", plat)
+}
+
+// DefaultAssets returns the archives of the default runner and pwsh versions for all supported platforms,
+// their sha256 is pinned in checksums.txt
+func DefaultAssets() []Asset {
+	plats := make([]string, 0, len(releaseArchs))
+	for plat := range releaseArchs {
+		plats = append(plats, plat)
+	}
+	slices.Sort(plats)
+	var assets []Asset
+	for _, plat := range plats {
+		runner, _ := RunnerAsset(plat, ActionsRunnerVersion)
+		server, _ := RunnerServerAsset(plat, RunnerServerRunnerVersion)
+		pwsh, _ := PwshAsset(plat, PwshVersion)
+		assets = append(assets, runner, server, pwsh)
+	}
+	return assets
+}
+
 // Official GitHub Actions Runner
-func DownloadRunner(ctx context.Context, logger Logger, plat string, dest string, version string) error {
-	AURL := func(arch, ext string) string {
-		return fmt.Sprintf("https://github.com/actions/runner/releases/download/v%s/actions-runner-%s-%s.%s", version, arch, version, ext)
-	}
-	download := map[string]string{
-		"windows/386":   AURL("win-x86", "zip"),
-		"windows/amd64": AURL("win-x64", "zip"),
-		"windows/arm64": AURL("win-arm64", "zip"),
-		"linux/amd64":   AURL("linux-x64", "tar.gz"),
-		"linux/arm":     AURL("linux-arm", "tar.gz"),
-		"linux/arm64":   AURL("linux-arm64", "tar.gz"),
-		"darwin/amd64":  AURL("osx-x64", "tar.gz"),
-		"darwin/arm64":  AURL("osx-arm64", "tar.gz"),
+func DownloadRunner(ctx context.Context, logger Logger, plat string, dest string, version string, urlTemplate string) error {
+	asset, err := RunnerAsset(plat, version)
+	if err != nil {
+		return err
 	}
 	// Includes the bin folder in the archive
-	return DownloadTool(ctx, logger, download[plat], dest)
+	return downloadRelease(ctx, logger, urlTemplate, asset, dest)
 }
 
 // Includes windows container support
-func DownloadRunnerServer(ctx context.Context, logger Logger, plat string, dest string, version string) error {
-	AURL := func(arch, ext string) string {
-		return fmt.Sprintf("https://github.com/ChristopherHX/runner.server/releases/download/v%s/runner.server-%s.%s", version, arch, ext)
-	}
-	download := map[string]string{
-		"windows/386":   AURL("win-x86", "zip"),
-		"windows/amd64": AURL("win-x64", "zip"),
-		"windows/arm64": AURL("win-arm64", "zip"),
-		"linux/amd64":   AURL("linux-x64", "tar.gz"),
-		"linux/arm":     AURL("linux-arm", "tar.gz"),
-		"linux/arm64":   AURL("linux-arm64", "tar.gz"),
-		"darwin/amd64":  AURL("osx-x64", "tar.gz"),
-		"darwin/arm64":  AURL("osx-arm64", "tar.gz"),
-	}
-	downloadURL, ok := download[plat]
-	if !ok {
-		return fmt.Errorf("unsupported platform %s", plat)
+func DownloadRunnerServer(ctx context.Context, logger Logger, plat string, dest string, version string, urlTemplate string) error {
+	asset, err := RunnerServerAsset(plat, version)
+	if err != nil {
+		return err
 	}
 	// Contains only the bin folder content
-	return DownloadTool(ctx, logger, downloadURL, filepath.Join(dest, "bin"))
+	if err := downloadRelease(ctx, logger, urlTemplate, asset, filepath.Join(dest, "bin")); err != nil {
+		os.RemoveAll(dest)
+		return err
+	}
+	return nil
 }
 
 // The windows version required pwsh to be able to send the job request, powershell 5 not supported
-func DownloadPwsh(ctx context.Context, logger Logger, plat string, dest string, version string) error {
-	AURL := func(arch, ext string) string {
-		return fmt.Sprintf("https://github.com/PowerShell/PowerShell/releases/download/v%s/powershell-%s-%s.%s", version, version, arch, ext)
-	}
-	download := map[string]string{
-		"windows/386":   AURL("win-x86", "zip"),
-		"windows/amd64": AURL("win-x64", "zip"),
-		"windows/arm64": AURL("win-arm64", "zip"),
-		"linux/amd64":   AURL("linux-x64", "tar.gz"),
-		"linux/arm":     AURL("linux-arm", "tar.gz"),
-		"linux/arm64":   AURL("linux-arm64", "tar.gz"),
-		"darwin/amd64":  AURL("osx-x64", "tar.gz"),
-		"darwin/arm64":  AURL("osx-arm64", "tar.gz"),
-	}
-	downloadURL, ok := download[plat]
-	if !ok {
-		return fmt.Errorf("unsupported platform %s", plat)
+func DownloadPwsh(ctx context.Context, logger Logger, plat string, dest string, version string, urlTemplate string) error {
+	asset, err := PwshAsset(plat, version)
+	if err != nil {
+		return err
 	}
-	// Contains only the bin folder content
-	return DownloadTool(ctx, logger, downloadURL, dest)
+	return downloadRelease(ctx, logger, urlTemplate, asset, dest)
 }
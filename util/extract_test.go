@@ -0,0 +1,101 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testArchive(t *testing.T) []byte {
+	archive := &bytes.Buffer{}
+	gz := gzip.NewWriter(archive)
+	tw := tar.NewWriter(gz)
+	content := []byte("echo hello")
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "tool/run.sh", Mode: 0o755, Size: int64(len(content))}))
+	_, _ = tw.Write(content)
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return archive.Bytes()
+}
+
+func TestDownloadToolChecksum(t *testing.T) {
+	archive := testArchive(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+
+	h := sha256.Sum256(archive)
+	dest := filepath.Join(t.TempDir(), "tool-1.0.0")
+	assert.NoError(t, DownloadTool(context.Background(), nil, server.URL+"/tool.tar.gz", dest, hex.EncodeToString(h[:])))
+	extracted, err := os.ReadFile(filepath.Join(dest, "run.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, "echo hello", string(extracted))
+
+	dest = filepath.Join(t.TempDir(), "tool-1.0.1")
+	err = DownloadTool(context.Background(), nil, server.URL+"/tool.tar.gz", dest, hex.EncodeToString(make([]byte, 32)))
+	assert.ErrorContains(t, err, "sha256")
+	_, err = os.Stat(dest)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadMirror(t *testing.T) {
+	archive := testArchive(t)
+	h := sha256.Sum256(archive)
+	asset := "powershell-7.4.7-linux-x64.tar.gz"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/PowerShell/PowerShell/v7.4.7/"+asset, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	})
+	mux.HandleFunc("/PowerShell/PowerShell/v7.4.7/"+asset+".sha256", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(hex.EncodeToString(h[:]) + "  " + asset))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "pwsh-7.4.7")
+	assert.NoError(t, DownloadPwsh(context.Background(), nil, "linux/amd64", dest, "7.4.7", server.URL+"/{repo}/{tag}/{asset}"))
+	_, err := os.Stat(filepath.Join(dest, "run.sh"))
+	assert.NoError(t, err)
+
+	// the mirror has no checksum for arm64
+	dest = filepath.Join(t.TempDir(), "pwsh-7.4.7")
+	assert.ErrorContains(t, DownloadPwsh(context.Background(), nil, "linux/arm64", dest, "7.4.7", server.URL+"/{repo}/{tag}/{asset}"), "no sha256 checksum")
+}
+
+func TestExtractArchive(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "actions-runner-linux-x64-2.329.0.tar.gz")
+	assert.NoError(t, os.WriteFile(file, testArchive(t), 0o644))
+	dest := filepath.Join(t.TempDir(), "actions-runner-2.329.0")
+	// unverified archives are rejected
+	assert.ErrorContains(t, ExtractArchive(nil, file, dest, false), "cannot verify")
+	_, err := os.Stat(dest)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, ExtractArchive(nil, file, dest, true))
+	_, err = os.Stat(filepath.Join(dest, "run.sh"))
+	assert.NoError(t, err)
+
+	// verified with the checksum next to the archive
+	h := sha256.Sum256(testArchive(t))
+	assert.NoError(t, os.WriteFile(file+".sha256", []byte(strings.ToUpper(hex.EncodeToString(h[:]))+"  "+filepath.Base(file)), 0o644))
+	assert.NoError(t, ExtractArchive(nil, file, dest, false))
+	assert.NoError(t, os.WriteFile(file+".sha256", []byte(hex.EncodeToString(make([]byte, 32))), 0o644))
+	assert.ErrorContains(t, ExtractArchive(nil, file, dest, true), "sha256")
+
+	unsupported := filepath.Join(t.TempDir(), "runner.7z")
+	assert.NoError(t, os.WriteFile(unsupported, []byte("7z"), 0o644))
+	assert.ErrorContains(t, ExtractArchive(nil, unsupported, dest, true), "unsupported archive")
+	_, err = os.Stat(dest)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,63 @@
+//go:build ignore
+
+// gen_checksums downloads the default runner and pwsh assets of all platforms and pins their sha256 in checksums.txt,
+// run it with go generate ./util after changing ActionsRunnerVersion, RunnerServerRunnerVersion or PwshVersion
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/ChristopherHX/gitea-actions-runner/util"
+)
+
+func main() {
+	ctx := context.Background()
+	out := &bytes.Buffer{}
+	fmt.Fprintln(out, "# Pinned sha256 checksums of the runner and pwsh downloads in the format of sha256sum:")
+	fmt.Fprintln(out, "# <sha256>  <release asset name>")
+	fmt.Fprintln(out, "# Generated by gen_checksums.go, downloads without an entry are verified with the checksums published by their github release.")
+	for _, asset := range util.DefaultAssets() {
+		sum, err := download(ctx, asset.URL(util.DefaultDownloadURL))
+		if err != nil {
+			log.Fatalf("%s: %v", asset.Name, err)
+		}
+		// compare with the published or the previously pinned checksum
+		if expected, err := util.ExpectedChecksum(ctx, asset.Repo, asset.Tag, asset.Name); err != nil {
+			log.Printf("%s: %v", asset.Name, err)
+		} else if expected != sum {
+			log.Fatalf("%s: sha256 is %s, expected %s", asset.Name, sum, expected)
+		}
+		fmt.Fprintf(out, "%s  %s\n", sum, asset.Name)
+	}
+	if err := os.WriteFile("checksums.txt", out.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func download(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download of %s failed with %s", url, rsp.Status)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rsp.Body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
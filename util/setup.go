@@ -18,13 +18,28 @@ const ActionsRunnerVersion string = "2.329.0"
 // https://github.com/christopherHX/runner.server/releases
 const RunnerServerRunnerVersion string = "3.13.7"
 
+// https://github.com/PowerShell/PowerShell/releases, used if neither python nor pwsh are installed
+const PwshVersion string = "7.4.7"
+
 //go:embed actions-runner-worker.py
 var pythonWorkerScript string
 
 //go:embed actions-runner-worker.ps1
 var pwshWorkerScript string
 
-func SetupRunner(runnerType int32, runnerVersion string) []string {
+// SetupOptions replaces the downloads of SetupRunner for hosts without access to github.com
+type SetupOptions struct {
+	// RunnerArchive is a local archive of the runner of the given type and version
+	RunnerArchive string
+	// PwshArchive is a local archive of pwsh used if neither python nor pwsh are installed
+	PwshArchive string
+	// DownloadURL is the url template of the release assets, defaults to DefaultDownloadURL
+	DownloadURL string
+	// InsecureSkipVerify extracts local archives without pinned sha256 or <archive>.sha256
+	InsecureSkipVerify bool
+}
+
+func SetupRunner(runnerType int32, runnerVersion string, opts SetupOptions) []string {
 	d := DownloadRunner
 	if runnerType == 2 {
 		d = DownloadRunnerServer
@@ -41,16 +56,29 @@ func SetupRunner(runnerType int32, runnerVersion string) []string {
 	if fi, err := os.Stat(p); err == nil && fi.IsDir() {
 		log.Infof("Runner %s already exists, skip downloading.", runnerVersion)
 	} else {
-		if err := d(context.Background(), log.StandardLogger(), runtime.GOOS+"/"+runtime.GOARCH, p, runnerVersion); err != nil {
+		var err error
+		if opts.RunnerArchive != "" {
+			dest := p
+			if runnerType == 2 {
+				// Contains only the bin folder content
+				dest = filepath.Join(p, "bin")
+			}
+			if err = ExtractArchive(log.StandardLogger(), opts.RunnerArchive, dest, opts.InsecureSkipVerify); err != nil {
+				os.RemoveAll(p)
+			}
+		} else {
+			err = d(context.Background(), log.StandardLogger(), runtime.GOOS+"/"+runtime.GOARCH, p, runnerVersion, opts.DownloadURL)
+		}
+		if err != nil {
 			log.Infoln("Something went wrong: %s" + err.Error())
 			return nil
 		}
 	}
 
-	return SetupWorker(wd, p, runnerType, runnerVersion)
+	return SetupWorker(wd, p, runnerType, runnerVersion, opts)
 }
 
-func SetupWorker(wd string, p string, runnerType int32, runnerVersion string) []string {
+func SetupWorker(wd string, p string, runnerType int32, runnerVersion string, opts SetupOptions) []string {
 	flags := []string{"--runner-dir=" + p, "--runner-type=" + fmt.Sprint(runnerType), "--runner-version=" + runnerVersion, "--allow-clone"}
 	pwshScript := filepath.Join(p, "actions-runner-worker.ps1")
 	_ = os.WriteFile(pwshScript, []byte(pwshWorkerScript), 0755)
@@ -71,13 +99,17 @@ func SetupWorker(wd string, p string, runnerType int32, runnerVersion string) []
 	if pythonPath == "" {
 		pwshPath, err := exec.LookPath("pwsh")
 		if err != nil {
-			pwshVersion := "7.4.7"
+			pwshVersion := PwshVersion
 			pwshPath = filepath.Join(wd, "pwsh-"+pwshVersion)
 			if fi, err := os.Stat(pwshPath); err == nil && fi.IsDir() {
 				log.Infof("pwsh %s already exists, skip downloading.", pwshVersion)
 			} else {
-				log.Infoln("pwsh not found, downloading pwsh...")
-				err = DownloadPwsh(context.Background(), log.StandardLogger(), runtime.GOOS+"/"+runtime.GOARCH, pwshPath, pwshVersion)
+				if opts.PwshArchive != "" {
+					err = ExtractArchive(log.StandardLogger(), opts.PwshArchive, pwshPath, opts.InsecureSkipVerify)
+				} else {
+					log.Infoln("pwsh not found, downloading pwsh...")
+					err = DownloadPwsh(context.Background(), log.StandardLogger(), runtime.GOOS+"/"+runtime.GOARCH, pwshPath, pwshVersion, opts.DownloadURL)
+				}
 				if err != nil {
 					log.Infoln("Something went wrong: %s" + err.Error())
 					return nil